@@ -0,0 +1,71 @@
+// Package cmderr classifies errors of the failed zfs, zpool, stmfadm and
+// itadm commands. Packages wrapping the commands alias Kind and its values.
+package cmderr
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// Kind - class of the error
+type Kind string
+
+const (
+	KindNotFound         Kind = "not_found"
+	KindAlreadyExists    Kind = "already_exists"
+	KindBusy             Kind = "busy"
+	KindPermissionDenied Kind = "permission_denied"
+	KindInvalidArgument  Kind = "invalid_argument"
+	KindBackend          Kind = "backend_failure"
+)
+
+// Message - first line of stderr, error description if stderr is empty
+func Message(err error, stderr string) string {
+	if line := strings.TrimSpace(strings.SplitN(strings.TrimSpace(stderr), "\n", 2)[0]); line != "" {
+		return line
+	}
+	return err.Error()
+}
+
+// Classify - kind of the failed command error by stderr and exit status.
+// usageStatus - exit status of usage errors, 0 if command doesn't have one.
+func Classify(err error, stderr string, usageStatus int) Kind {
+	// command could not be started
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return KindBackend
+	}
+
+	msg := strings.ToLower(stderr)
+
+	switch {
+	case strings.Contains(msg, "permission denied"),
+		strings.Contains(msg, "not permitted"),
+		strings.Contains(msg, "insufficient privileges"):
+		return KindPermissionDenied
+	case strings.Contains(msg, "already exists"):
+		return KindAlreadyExists
+	case strings.Contains(msg, "does not exist"),
+		strings.Contains(msg, "not found"),
+		strings.Contains(msg, "no views found"),
+		strings.Contains(msg, "no such"):
+		return KindNotFound
+	case strings.Contains(msg, "busy"),
+		strings.Contains(msg, "in use"),
+		strings.Contains(msg, "has children"),
+		strings.Contains(msg, "has dependent clones"):
+		return KindBusy
+	case strings.Contains(msg, "invalid"),
+		strings.Contains(msg, "bad property value"),
+		strings.Contains(msg, "must be"),
+		strings.Contains(msg, "unrecognized"),
+		strings.Contains(msg, "usage:"):
+		return KindInvalidArgument
+	}
+
+	if usageStatus != 0 && exitErr.ExitCode() == usageStatus {
+		return KindInvalidArgument
+	}
+
+	return KindBackend
+}
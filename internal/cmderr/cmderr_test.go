@@ -0,0 +1,79 @@
+package cmderr
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+)
+
+// exitError - ExitError of the command exited with specified status
+func exitError(t *testing.T, status string) error {
+	err := exec.Command("sh", "-c", "exit "+status).Run()
+	if _, ok := err.(*exec.ExitError); !ok {
+		t.Fatalf("exit %s: expected ExitError, got %v", status, err)
+	}
+	return err
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		status      string
+		stderr      string
+		usageStatus int
+		kind        Kind
+	}{
+		{"1", "cannot open 'tank/vol': dataset does not exist\n", 2, KindNotFound},
+		{"1", "stmfadm: 600144F0: not found\n", 0, KindNotFound},
+		{"1", "itadm: No such target\n", 0, KindNotFound},
+		{"1", "stmfadm: 600144F0: no views found\n", 0, KindNotFound},
+		{"1", "cannot create 'tank/vol': dataset already exists\n", 2, KindAlreadyExists},
+		{"1", "stmfadm: hg1: already exists\n", 0, KindAlreadyExists},
+		{"1", "cannot destroy 'tank/vol': dataset is busy\n", 2, KindBusy},
+		{"1", "stmfadm: resource busy\n", 0, KindBusy},
+		{"1", "cannot destroy 'tank/fs': filesystem has children\n", 2, KindBusy},
+		{"1", "cannot create 'tank/vol': permission denied\n", 2, KindPermissionDenied},
+		{"1", "Insufficient privileges\n", 0, KindPermissionDenied},
+		{"1", "'volsize' must be a multiple of volume block size\n", 2, KindInvalidArgument},
+		{"1", "stmfadm: invalid option -- 'z'\n", 0, KindInvalidArgument},
+		{"2", "unrecognized command 'lst'\nusage: zfs command args ...\n", 2, KindInvalidArgument},
+		{"2", "missing dataset argument\n", 2, KindInvalidArgument},
+		{"2", "missing dataset argument\n", 0, KindBackend},
+		{"1", "internal error: out of memory\n", 2, KindBackend},
+		{"1", "", 0, KindBackend},
+	}
+
+	for _, test := range tests {
+		kind := Classify(exitError(t, test.status), test.stderr, test.usageStatus)
+		if kind != test.kind {
+			t.Errorf("exit %s, %q: kind %s, expected %s", test.status, test.stderr, kind, test.kind)
+		}
+	}
+}
+
+func TestClassifyNotStarted(t *testing.T) {
+	_, err := exec.Command("/nonexistent/zfs").Output()
+
+	if kind := Classify(err, "permission denied", 2); kind != KindBackend {
+		t.Errorf("kind %s, expected %s", kind, KindBackend)
+	}
+}
+
+func TestMessage(t *testing.T) {
+	err := errors.New("exit status 1")
+
+	tests := []struct {
+		stderr   string
+		expected string
+	}{
+		{"cannot destroy 'tank/vol': dataset is busy\nsecond line\n", "cannot destroy 'tank/vol': dataset is busy"},
+		{"\n  stmfadm: not found  \n", "stmfadm: not found"},
+		{"", "exit status 1"},
+		{" \n ", "exit status 1"},
+	}
+
+	for _, test := range tests {
+		if message := Message(err, test.stderr); message != test.expected {
+			t.Errorf("%q: message %q, expected %q", test.stderr, message, test.expected)
+		}
+	}
+}
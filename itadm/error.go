@@ -1,15 +1,86 @@
 package itadm
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
 
-// Error structure
+	"github.com/d-helios/znstord/internal/cmderr"
+)
+
+// Kind - class of the error
+type Kind = cmderr.Kind
+
+const (
+	KindNotFound         = cmderr.KindNotFound
+	KindAlreadyExists    = cmderr.KindAlreadyExists
+	KindBusy             = cmderr.KindBusy
+	KindPermissionDenied = cmderr.KindPermissionDenied
+	KindInvalidArgument  = cmderr.KindInvalidArgument
+	KindBackend          = cmderr.KindBackend
+)
+
+// Sentinel errors. errors.Is(err, ErrNotFound) matches any Error of the same kind.
+var (
+	ErrNotFound         = &Error{Err: errors.New("not found"), Kind: KindNotFound}
+	ErrAlreadyExists    = &Error{Err: errors.New("already exists"), Kind: KindAlreadyExists}
+	ErrBusy             = &Error{Err: errors.New("busy"), Kind: KindBusy}
+	ErrPermissionDenied = &Error{Err: errors.New("permission denied"), Kind: KindPermissionDenied}
+	ErrInvalidArgument  = &Error{Err: errors.New("invalid argument"), Kind: KindInvalidArgument}
+	ErrBackend          = &Error{Err: errors.New("backend failure"), Kind: KindBackend}
+)
+
+// Error - common error structure.
+// Errors without kind are backend failures.
 type Error struct {
 	Err    error
 	Debug  string
 	Stderr string
+	Kind   Kind
 }
 
 // returns the string representation of an Error.
 func (e Error) Error() string {
 	return fmt.Sprintf("%s: %q => %s", e.Err, e.Debug, e.Stderr)
 }
+
+// Is - errors of the same kind are equal
+func (e Error) Is(target error) bool {
+	switch t := target.(type) {
+	case *Error:
+		return e.kind() == t.kind()
+	case Error:
+		return e.kind() == t.kind()
+	}
+	return false
+}
+
+// ErrorKind - kind of the error as string
+func (e Error) ErrorKind() string {
+	return string(e.kind())
+}
+
+// Message - error description without command line and stderr
+func (e Error) Message() string {
+	if e.Err == nil {
+		return string(e.kind())
+	}
+	return e.Err.Error()
+}
+
+func (e Error) kind() Kind {
+	if e.Kind == "" {
+		return KindBackend
+	}
+	return e.Kind
+}
+
+// commandError - error of the failed command, classified by stderr and exit code.
+// First line of stderr is used as error description.
+func commandError(err error, debug, stderr string) *Error {
+	return &Error{
+		Err:    errors.New(cmderr.Message(err, stderr)),
+		Debug:  debug + ": " + err.Error(),
+		Stderr: stderr,
+		Kind:   cmderr.Classify(err, stderr, 0),
+	}
+}
@@ -0,0 +1,29 @@
+package stmf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLuPropertiesArgs(t *testing.T) {
+	empty := ""
+	url := "http://mgmt.example.com"
+	writeProtect := true
+
+	tests := []struct {
+		props    LuProperties
+		expected []string
+	}{
+		{LuProperties{}, []string{}},
+		{LuProperties{Alias: "vol1", VendorID: ""}, []string{"-p", "alias=vol1"}},
+		{LuProperties{ManagementURL: &url}, []string{"-p", "mgmt-url=" + url}},
+		{LuProperties{ManagementURL: &empty}, []string{"-p", "mgmt-url="}},
+		{LuProperties{WriteProtect: &writeProtect, Size: 1024}, []string{"-p", "wp=true", "-s", "1024"}},
+	}
+
+	for _, test := range tests {
+		if args := test.props.args(); !reflect.DeepEqual(args, test.expected) {
+			t.Errorf("%+v: args %q, expected %q", test.props, args, test.expected)
+		}
+	}
+}
@@ -46,6 +46,7 @@ func ListLUs(luName string) ([]*LogicalUnit, error) {
 	// stmfadm list-logicalunit output at least 16 lines
 	if len(out) < 17 {
 		return nil, &Error{
+			Err:    errors.New("Unexpected stmfadm list-lu output"),
 			Debug:  "stmfadm " + strings.Join(args, " "),
 			Stderr: fmt.Sprintf("%q\n", out),
 		}
@@ -119,8 +120,9 @@ func GetLuByZvol(zvol string) (*LogicalUnit, error) {
 	}
 
 	return nil, &Error{
-		Err:    err,
-		Debug:  fmt.Sprintf("LogicalUnit not found. ZVOL: %s. LUs: %q", zvol, LUs),
+		Err:    errors.New("LogicalUnit not found"),
+		Kind:   KindNotFound,
+		Debug:  fmt.Sprintf("LogicalUnit not found. ZVOL: %s. LUs: %v", zvol, LUs),
 		Stderr: "",
 	}
 }
@@ -140,22 +142,47 @@ func GetLuByAlias(alias string) (*LogicalUnit, error) {
 	}
 
 	return nil, &Error{
-		Err:    err,
+		Err:    errors.New("LogicalUnit not found"),
+		Kind:   KindNotFound,
 		Debug:  fmt.Sprintf("LogicalUnit not found. Alias: %s", alias),
 		Stderr: "",
 	}
 }
 
-// CreateLu - create logical unit. zvol is only supported backend
+// CreateLuWithProps - create logical unit on the zvol.
+// Default block size is used if not specified.
+func CreateLuWithProps(zvol string, props LuProperties) (*LogicalUnit, error) {
+	args := props.args()
+
+	if props.BlockSize == 0 {
+		args = append([]string{"-p", "blk=" + defaultVolBlockSize}, args...)
+	}
+
+	return createLu(zvol, args)
+}
+
+// CreateLu - create logical unit with space separated create-lu options.
+//
+// Deprecated: options containing spaces are split. Use CreateLuWithProps.
 func CreateLu(zvol, opts string) (*LogicalUnit, error) {
+	args := []string{}
+
 	// default options is -p blk=4096
-	args := []string{"create-lu", "-p", "blk=" + defaultVolBlockSize}
+	if !strings.Contains(opts, "blk=") {
+		args = append(args, "-p", "blk="+defaultVolBlockSize)
+	}
 
 	if opts != "" {
 		optionLists := strings.Split(opts, " ")
 		args = append(args, optionLists...)
 	}
 
+	return createLu(zvol, args)
+}
+
+func createLu(zvol string, options []string) (*LogicalUnit, error) {
+	args := []string{"create-lu"}
+	args = append(args, options...)
 	args = append(args, RDSK_DEFAULT_PREFIX+zvol)
 
 	output, err := cmdStmfadm(args...)
@@ -179,6 +206,45 @@ func CreateLu(zvol, opts string) (*LogicalUnit, error) {
 	return lu, nil
 }
 
+// args - create-lu/modify-lu arguments. Each value is a separate argument
+func (props LuProperties) args() []string {
+	args := []string{}
+
+	for _, prop := range []struct{ name, value string }{
+		{"guid", props.Guid},
+		{"alias", props.Alias},
+		{"serial", props.Serial},
+		{"vid", props.VendorID},
+		{"pid", props.ProductID},
+	} {
+		if prop.value != "" {
+			args = append(args, "-p", prop.name+"="+prop.value)
+		}
+	}
+
+	if props.ManagementURL != nil {
+		args = append(args, "-p", "mgmt-url="+*props.ManagementURL)
+	}
+
+	if props.BlockSize != 0 {
+		args = append(args, "-p", "blk="+strconv.FormatUint(props.BlockSize, 10))
+	}
+
+	if props.WriteProtect != nil {
+		args = append(args, "-p", "wp="+strconv.FormatBool(*props.WriteProtect))
+	}
+
+	if props.WriteCacheDisabled != nil {
+		args = append(args, "-p", "wcd="+strconv.FormatBool(*props.WriteCacheDisabled))
+	}
+
+	if props.Size != 0 {
+		args = append(args, "-s", strconv.FormatUint(props.Size, 10))
+	}
+
+	return args
+}
+
 // Offline - set logical unit Offline
 func (logicalunit *LogicalUnit) Offline() error {
 	args := []string{"offline-lu"}
@@ -218,20 +284,33 @@ func (logicalunit *LogicalUnit) Online() error {
 	return nil
 }
 
-// Modify logical unit stmf properties or zvol properties
-func (logicalunit *LogicalUnit) Modify(opts string) error {
-	args := []string{"modify-lu"}
+// ModifyWithProps - modify logical unit properties
+func (logicalunit *LogicalUnit) ModifyWithProps(props LuProperties) error {
+	return logicalunit.modify(props.args())
+}
 
+// Modify - modify logical unit with space separated modify-lu options.
+//
+// Deprecated: options containing spaces are split. Use ModifyWithProps.
+func (logicalunit *LogicalUnit) Modify(opts string) error {
 	if opts == "" {
 		// nothing to modify. exit
 		return nil
 	}
 
-	for _, parameter := range strings.Split(opts, " ") {
-		args = append(args, parameter)
+	return logicalunit.modify(strings.Split(opts, " "))
+}
+
+func (logicalunit *LogicalUnit) modify(options []string) error {
+	if len(options) == 0 {
+		// nothing to modify. exit
+		return nil
 	}
 
+	args := []string{"modify-lu"}
+	args = append(args, options...)
 	args = append(args, logicalunit.LUName)
+
 	_, err := cmdStmfadm(args...)
 
 	if err != nil {
@@ -334,6 +413,7 @@ func (logicalunit *LogicalUnit) GetViewEntry(hostgroup, targetgroup string) (*Vi
 	}
 	return nil, &Error{
 		Err:    errors.New("View Entry not found"),
+		Kind:   KindNotFound,
 		Debug:  fmt.Sprintf("LU %s exported to %q", logicalunit.LUName, Views),
 		Stderr: "",
 	}
@@ -478,6 +558,7 @@ func CreateHostGroup(hg string) (*HostGroup, error) {
 	if hg == "All" {
 		return nil, &Error{
 			Err:    errors.New("TargetName - All, not allowed"),
+			Kind:   KindInvalidArgument,
 			Debug:  fmt.Sprintf("TargetGroup: %s", hg),
 			Stderr: "",
 		}
@@ -598,6 +679,7 @@ func CreateTargetGroup(tg string) (*TargetGroup, error) {
 	if tg == "All" {
 		return nil, &Error{
 			Err:    errors.New("TargetName - All, not allowed"),
+			Kind:   KindInvalidArgument,
 			Debug:  fmt.Sprintf("TargetGroup: %s", tg),
 			Stderr: "",
 		}
@@ -656,7 +738,31 @@ func (tg *TargetGroup) Delete() error {
 
 // ListTargetGroups - list target groups
 func ListTargetGroups() ([]*TargetGroup, error) {
-	args := []string{"list-tg"}
+	return listTargetGroups("")
+}
+
+// GetTargetGroup - get specified target groups
+func GetTargetGroup(tg string) (*TargetGroup, error) {
+	tgList, err := listTargetGroups(tg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tgList) > 0 {
+		return tgList[0], nil
+	}
+
+	return nil, nil
+}
+
+// listTargetGroups - stmfadm list-tg -v [targetgroup]
+func listTargetGroups(tg string) ([]*TargetGroup, error) {
+	args := []string{"list-tg", "-v"}
+
+	if tg != "" {
+		args = append(args, tg)
+	}
 
 	out, err := cmdStmfadm(args...)
 
@@ -665,17 +771,31 @@ func ListTargetGroups() ([]*TargetGroup, error) {
 	}
 
 	var tgList []*TargetGroup
+	var targetGroup *TargetGroup
 
-	for _, target := range out {
-		tgList = append(tgList, &TargetGroup{TargetGroup: target[1]})
+	for i := 0; i < len(out); i++ {
+		if len(out[i]) < 2 {
+			continue
+		}
+
+		switch strings.TrimSpace(out[i][0]) {
+		case "Target Group":
+			targetGroup = &TargetGroup{TargetGroup: out[i][1]}
+			tgList = append(tgList, targetGroup)
+		case "Member":
+			if targetGroup != nil {
+				targetGroup.TargetPortGroup = append(targetGroup.TargetPortGroup,
+					strings.TrimSpace(strings.Join(out[i][1:], ":")))
+			}
+		}
 	}
 
 	return tgList, nil
 }
 
-// GetTargetGroup - get specified target groups
-func GetTargetGroup(tg string) (*TargetGroup, error) {
-	args := []string{"list-tg", tg}
+// ListTargets - list targets with logged in sessions. stmfadm list-target -v
+func ListTargets() ([]*Target, error) {
+	args := []string{"list-target", "-v"}
 
 	out, err := cmdStmfadm(args...)
 
@@ -683,17 +803,45 @@ func GetTargetGroup(tg string) (*TargetGroup, error) {
 		return nil, err
 	}
 
-	var tgList []*TargetGroup
+	var targets []*Target
+	var target *Target
+	var session *Session
 
-	for _, target := range out {
-		tgList = append(tgList, &TargetGroup{TargetGroup: target[1]})
-	}
+	for i := 0; i < len(out); i++ {
+		if len(out[i]) < 2 {
+			continue
+		}
 
-	if len(tgList) > 0 {
-		return tgList[0], nil
+		value := strings.TrimSpace(strings.Join(out[i][1:], ":"))
+
+		switch strings.TrimSpace(out[i][0]) {
+		case "Target":
+			target = &Target{Target: value}
+			session = nil
+			targets = append(targets, target)
+		case "Operational Status":
+			target.OperationalStatus = value
+		case "Provider Name":
+			target.ProviderName = value
+		case "Protocol":
+			target.Protocol = value
+		case "Initiator":
+			target.Sessions = append(target.Sessions, Session{Initiator: value})
+			session = &target.Sessions[len(target.Sessions)-1]
+		case "Alias":
+			if session != nil {
+				session.Alias = value
+			} else {
+				target.Alias = value
+			}
+		case "Logged in since":
+			if session != nil {
+				session.LoggedInSince = value
+			}
+		}
 	}
 
-	return nil, nil
+	return targets, nil
 }
 
 // BackupSTMFConfiguration - Backup Configuration (RSF-1 Cluster)
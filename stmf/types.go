@@ -30,12 +30,46 @@ type LogicalUnit struct {
 	AccessState          string `json:"AccessState"`
 }
 
+// LuProperties - properties of create-lu and modify-lu.
+// Empty values are not passed, except ManagementURL: nil is not passed,
+// empty string clears it. Guid, BlockSize, Serial, VendorID and
+// ProductID are accepted by create-lu only.
+type LuProperties struct {
+	Guid               string
+	Alias              string
+	BlockSize          uint64
+	Serial             string
+	VendorID           string
+	ProductID          string
+	ManagementURL      *string
+	WriteProtect       *bool
+	WriteCacheDisabled *bool
+	Size               uint64
+}
+
 // TargetGroup - representation of stmfadm list-tg
 type TargetGroup struct {
 	TargetGroup     string   `json:"TargetGroup"`
 	TargetPortGroup []string `json:"TargetPortGroup"`
 }
 
+// Target - representation of stmfadm list-target -v output
+type Target struct {
+	Target            string    `json:"Target"`
+	OperationalStatus string    `json:"OperationalStatus"`
+	ProviderName      string    `json:"ProviderName"`
+	Alias             string    `json:"Alias"`
+	Protocol          string    `json:"Protocol"`
+	Sessions          []Session `json:"Sessions"`
+}
+
+// Session - initiator logged in to the target
+type Session struct {
+	Initiator     string `json:"Initiator"`
+	Alias         string `json:"Alias"`
+	LoggedInSince string `json:"LoggedInSince"`
+}
+
 // View - representation of stmadm list-view -l wwid
 type View struct {
 	ViewEntry   uint64 `json:"ViewEntry"`
@@ -58,11 +58,7 @@ func (c *command) Run(filter string, arg ...string) ([][]string, error) {
 	err := cmd.Run()
 
 	if err != nil {
-		return nil, &Error{
-			Err:    err,
-			Debug:  strings.Join([]string{cmd.Path, c.Command, joinedArgs}, " "),
-			Stderr: stderr.String(),
-		}
+		return nil, commandError(err, strings.Join([]string{cmd.Path, c.Command, joinedArgs}, " "), stderr.String())
 	}
 
 	lines := strings.Split(stdout.String(), "\n")
@@ -0,0 +1,67 @@
+package zfs
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+)
+
+// exitError - ExitError of the command exited with specified status
+func exitError(t *testing.T, status string) error {
+	err := exec.Command("sh", "-c", "exit "+status).Run()
+	if _, ok := err.(*exec.ExitError); !ok {
+		t.Fatalf("exit %s: expected ExitError, got %v", status, err)
+	}
+	return err
+}
+
+func TestCommandErrorKind(t *testing.T) {
+	tests := []struct {
+		status string
+		stderr string
+		kind   Kind
+	}{
+		{"1", "cannot open 'tank/vol': dataset does not exist\n", KindNotFound},
+		{"1", "cannot create 'tank/vol': dataset already exists\n", KindAlreadyExists},
+		{"1", "cannot destroy 'tank/vol': dataset is busy\n", KindBusy},
+		{"1", "cannot destroy 'tank/fs': filesystem has children\n", KindBusy},
+		{"1", "cannot create 'tank/vol': permission denied\n", KindPermissionDenied},
+		{"1", "cannot set property for 'tank/vol': 'volsize' must be a multiple of volume block size\n", KindInvalidArgument},
+		{"2", "unrecognized command 'lst'\nusage: zfs command args ...\n", KindInvalidArgument},
+		{"2", "missing dataset argument\n", KindInvalidArgument},
+		{"1", "internal error: out of memory\n", KindBackend},
+	}
+
+	for _, test := range tests {
+		err := commandError(exitError(t, test.status), "zfs", test.stderr)
+		if err.Kind != test.kind {
+			t.Errorf("%q: kind %s, expected %s", test.stderr, err.Kind, test.kind)
+		}
+	}
+}
+
+func TestCommandErrorMessage(t *testing.T) {
+	err := commandError(exitError(t, "1"), "zfs destroy tank/vol",
+		"cannot destroy 'tank/vol': dataset is busy\nsecond line\n")
+
+	if err.Message() != "cannot destroy 'tank/vol': dataset is busy" {
+		t.Errorf("unexpected message: %q", err.Message())
+	}
+
+	if !errors.Is(err, ErrBusy) {
+		t.Errorf("errors.Is(%v, ErrBusy) = false", err)
+	}
+
+	if errors.Is(err, ErrNotFound) {
+		t.Errorf("errors.Is(%v, ErrNotFound) = true", err)
+	}
+}
+
+func TestCommandErrorNotStarted(t *testing.T) {
+	_, runErr := exec.Command("/nonexistent/zfs").Output()
+	err := commandError(runErr, "/nonexistent/zfs", "")
+
+	if err.ErrorKind() != string(KindBackend) {
+		t.Errorf("kind %s, expected %s", err.ErrorKind(), KindBackend)
+	}
+}
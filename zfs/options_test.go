@@ -0,0 +1,53 @@
+package zfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPropertyMapArgs(t *testing.T) {
+	props := PropertyMap{
+		"volblocksize": "8192",
+		"custom:alias": "my volume",
+		"compression":  "lz4",
+	}
+
+	expected := []string{
+		"-o", "compression=lz4",
+		"-o", "custom:alias=my volume",
+		"-o", "volblocksize=8192",
+	}
+
+	if args := props.args(); !reflect.DeepEqual(args, expected) {
+		t.Errorf("args %q, expected %q", args, expected)
+	}
+}
+
+func TestDestroyFlagsArgs(t *testing.T) {
+	tests := []struct {
+		flags    DestroyFlags
+		expected []string
+	}{
+		{DestroyFlags{}, []string{}},
+		{DestroyFlags{Recursive: true}, []string{"-r"}},
+		{DestroyFlags{Dependents: true, Force: true}, []string{"-R", "-f"}},
+		{DestroyFlags{Defer: true}, []string{"-d"}},
+	}
+
+	for _, test := range tests {
+		if args := test.flags.args(); !reflect.DeepEqual(args, test.expected) {
+			t.Errorf("%+v: args %q, expected %q", test.flags, args, test.expected)
+		}
+	}
+}
+
+func TestSplitOptions(t *testing.T) {
+	if args := splitOptions("  "); len(args) != 0 {
+		t.Errorf("blank options: %q", args)
+	}
+
+	expected := []string{"-o", "quota=1024", "-o", "atime=off"}
+	if args := splitOptions(" -o quota=1024 -o atime=off "); !reflect.DeepEqual(args, expected) {
+		t.Errorf("args %q, expected %q", args, expected)
+	}
+}
@@ -0,0 +1,73 @@
+package zfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+// captured `zfs get -Hp -o property,value,source all tank/fs`
+const zfsGetOutput = "type\tfilesystem\t-\n" +
+	"used\t98304\t-\n" +
+	"quota\t1073741824\tlocal\n" +
+	"compression\tlz4\tinherited from tank\n" +
+	"mountpoint\t/export/my share\tlocal\n" +
+	"sharenfs\trw=@10.0.0.0/24,root=host a\tlocal\n" +
+	"atime\ton\tdefault\n" +
+	"clones\t\t-\n" +
+	"custom:alias\tmy project\tlocal\n"
+
+func TestRunTabFilter(t *testing.T) {
+	c := command{Command: "printf"}
+
+	out, err := c.Run(tabFilter, "%s", zfsGetOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(out) != 9 {
+		t.Fatalf("%d lines, 9 expected", len(out))
+	}
+
+	expected := []string{"mountpoint", "/export/my share", "local"}
+	if !reflect.DeepEqual(out[4], expected) {
+		t.Errorf("line %q, expected %q", out[4], expected)
+	}
+
+	expected = []string{"clones", "", "-"}
+	if !reflect.DeepEqual(out[7], expected) {
+		t.Errorf("line %q, expected %q", out[7], expected)
+	}
+}
+
+func TestParseProperties(t *testing.T) {
+	c := command{Command: "printf"}
+	out, err := c.Run(tabFilter, "%s", zfsGetOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	props, err := parseProperties(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]Property{
+		"type":         {Value: "filesystem", Source: SourceNone},
+		"quota":        {Value: "1073741824", Source: SourceLocal},
+		"compression":  {Value: "lz4", Source: SourceInherited, InheritedFrom: "tank"},
+		"sharenfs":     {Value: "rw=@10.0.0.0/24,root=host a", Source: SourceLocal},
+		"atime":        {Value: "on", Source: SourceDefault},
+		"clones":       {Value: "", Source: SourceNone},
+		"custom:alias": {Value: "my project", Source: SourceLocal},
+	}
+
+	for name, expected := range tests {
+		if props[name] != expected {
+			t.Errorf("%s: %+v, expected %+v", name, props[name], expected)
+		}
+	}
+
+	if _, err := parseProperties([][]string{{"quota", "1024"}}); err == nil {
+		t.Error("expected error on missing source column")
+	}
+}
@@ -49,8 +49,40 @@ var FloatProps = []string{
 
 // Dataset - common dataset structure.
 type Dataset struct {
-	Dataset string      `json:"dataset"`
-	Props   interface{} `json:"options"`
+	Dataset    string      `json:"dataset"`
+	Props      interface{} `json:"options"`
+	Properties Properties  `json:"properties,omitempty"`
+}
+
+// Property sources (zfs get -o source)
+const (
+	SourceLocal     = "local"
+	SourceDefault   = "default"
+	SourceInherited = "inherited"
+	SourceTemporary = "temporary"
+	SourceReceived  = "received"
+	SourceNone      = "none"
+)
+
+// Property - value of the dataset property together with its source.
+type Property struct {
+	Value         string `json:"value"`
+	Source        string `json:"source"`
+	InheritedFrom string `json:"inherited_from,omitempty"`
+}
+
+// Properties - all properties of the dataset (zfs get all), including user properties.
+type Properties map[string]Property
+
+// PropertyMap - properties of the created dataset (zfs create -o name=value).
+type PropertyMap map[string]string
+
+// DestroyFlags - options of zfs destroy.
+type DestroyFlags struct {
+	Recursive  bool // -r, destroy descendents
+	Dependents bool // -R, destroy descendents and clones outside the hierarchy
+	Force      bool // -f, unmount busy filesystems
+	Defer      bool // -d, defer snapshot deletion
 }
 
 // FsDataset - zfs filesystem dataset.
@@ -159,3 +191,63 @@ type SnapDataset struct {
 	Alias           string  `json:"custom:alias"`
 	SFlag           string  `json:"service_flag"`
 }
+
+// Pool - zfs pool capacity and health (zpool list).
+type Pool struct {
+	Name          string  `json:"name"`
+	Size          uint64  `json:"size"`
+	Allocated     uint64  `json:"allocated"`
+	Free          uint64  `json:"free"`
+	Fragmentation uint64  `json:"fragmentation"`
+	Capacity      uint64  `json:"capacity"`
+	Health        string  `json:"health"`
+	DedupRatio    float64 `json:"dedupratio"`
+}
+
+// PoolStatus - zfs pool status (zpool status).
+type PoolStatus struct {
+	Name   string  `json:"name"`
+	State  string  `json:"state"`
+	Status string  `json:"status,omitempty"`
+	Action string  `json:"action,omitempty"`
+	See    string  `json:"see,omitempty"`
+	Scan   string  `json:"scan,omitempty"`
+	Errors string  `json:"errors,omitempty"`
+	Config []*Vdev `json:"config"`
+
+	ScanStatus *ScanStatus `json:"scan_status"`
+}
+
+// Scan states
+const (
+	ScanStateNone       = "none"
+	ScanStateInProgress = "in progress"
+	ScanStatePaused     = "paused"
+	ScanStateCanceled   = "canceled"
+	ScanStateFinished   = "finished"
+	ScanStateUnknown    = "unknown"
+)
+
+// ScanStatus - progress or result of the last scrub or resilver.
+// Raw holds scan line of zpool status as is.
+type ScanStatus struct {
+	Function string  `json:"function,omitempty"`
+	State    string  `json:"state"`
+	Progress float64 `json:"progress"`
+	Repaired string  `json:"repaired,omitempty"`
+	Errors   string  `json:"errors,omitempty"`
+	Time     string  `json:"time,omitempty"`
+	Raw      string  `json:"raw"`
+}
+
+// Vdev - virtual device of the pool configuration.
+// Error counters are kept as reported by zpool (ex: 1.2K).
+type Vdev struct {
+	Name     string  `json:"name"`
+	State    string  `json:"state,omitempty"`
+	Read     string  `json:"read,omitempty"`
+	Write    string  `json:"write,omitempty"`
+	Checksum string  `json:"cksum,omitempty"`
+	Message  string  `json:"message,omitempty"`
+	Children []*Vdev `json:"children,omitempty"`
+}
@@ -3,6 +3,7 @@ package zfs
 import (
 	"bytes"
 	"io"
+	"os"
 	"os/exec"
 	"reflect"
 	"strconv"
@@ -16,13 +17,12 @@ type command struct {
 	Stdout  io.Writer
 }
 
+// tabFilter - split output of the scripted mode (-H) strictly on tabs.
+// Empty columns are kept.
+const tabFilter = "\t"
+
 // wrapper for exec/Command
 func (c *command) Run(filter string, arg ...string) ([][]string, error) {
-
-	cmd := exec.Command(c.Command, arg...)
-
-	var stdout, stderr bytes.Buffer
-
 	functionFilter := func(r rune) bool { return true }
 
 	if filter == ":" {
@@ -31,22 +31,12 @@ func (c *command) Run(filter string, arg ...string) ([][]string, error) {
 		functionFilter = unicode.IsSpace
 	}
 
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	joinedArgs := strings.Join(cmd.Args, " ")
-
-	err := cmd.Run()
-
+	stdout, err := c.Output(arg...)
 	if err != nil {
-		return nil, &Error{
-			Err:    err,
-			Debug:  strings.Join([]string{cmd.Path, c.Command, joinedArgs}, " "),
-			Stderr: stderr.String(),
-		}
+		return nil, err
 	}
 
-	lines := strings.Split(stdout.String(), "\n")
+	lines := strings.Split(stdout, "\n")
 
 	// last line is always blank
 	lines = lines[0 : len(lines)-1]
@@ -54,22 +44,101 @@ func (c *command) Run(filter string, arg ...string) ([][]string, error) {
 	output := make([][]string, len(lines))
 
 	for i, j := range lines {
+		if filter == tabFilter {
+			output[i] = strings.Split(j, "\t")
+			continue
+		}
 		output[i] = strings.FieldsFunc(j, functionFilter)
 	}
 
 	return output, nil
 }
 
-// wrapper for cmdZfs calls
+// Output - run command and return raw stdout.
+// Used when layout of the output (ex: indentation) is significant.
+func (c *command) Output(arg ...string) (string, error) {
+	cmd := exec.Command(c.Command, arg...)
+
+	var stdout, stderr bytes.Buffer
+
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	joinedArgs := strings.Join(cmd.Args, " ")
+
+	err := cmd.Run()
+
+	if err != nil {
+		return "", commandError(err, strings.Join([]string{cmd.Path, c.Command, joinedArgs}, " "), stderr.String())
+	}
+
+	return stdout.String(), nil
+}
+
+// wrapper for cmdZfs calls. Output is expected in scripted mode (-H)
 func cmdZfs(arg ...string) ([][]string, error) {
 	c := command{Command: "zfs"}
-	return c.Run("", arg...)
+	return c.Run(tabFilter, arg...)
 }
 
-// wrapper for cmdZpool calls
+// wrapper for cmdZpool calls. Output is expected in scripted mode (-H)
 func cmdZpool(arg ...string) ([][]string, error) {
 	c := command{Command: "zpool"}
-	return c.Run("", arg...)
+	return c.Run(tabFilter, arg...)
+}
+
+// pipe output of the first zfs command to the second one.
+// ex: zfs send tank/vol@snap | zfs recv pool/vol
+func cmdZfsPipe(srcArgs, dstArgs []string) error {
+	src := exec.Command("zfs", srcArgs...)
+	dst := exec.Command("zfs", dstArgs...)
+
+	var srcStderr, dstStderr bytes.Buffer
+	src.Stderr = &srcStderr
+	dst.Stderr = &dstStderr
+
+	joinedArgs := strings.Join(src.Args, " ") + " | " + strings.Join(dst.Args, " ")
+
+	pipeReader, pipeWriter, err := os.Pipe()
+	if err != nil {
+		return commandError(err, joinedArgs, "")
+	}
+	src.Stdout = pipeWriter
+	dst.Stdin = pipeReader
+
+	err = dst.Start()
+	// only the child keeps the read end, so src gets EPIPE if dst exits early
+	pipeReader.Close()
+	if err != nil {
+		pipeWriter.Close()
+		return commandError(err, joinedArgs, dstStderr.String())
+	}
+
+	err = src.Start()
+	// only the child keeps the write end, so dst gets EOF when src exits
+	pipeWriter.Close()
+	if err != nil {
+		dst.Process.Kill()
+		dst.Wait()
+		return commandError(err, joinedArgs, srcStderr.String())
+	}
+
+	dstErr := dst.Wait()
+	if dstErr != nil {
+		src.Process.Kill()
+	}
+	srcErr := src.Wait()
+
+	// failure of dst (ex: quota exceeded) is the cause of src failure
+	if dstErr != nil {
+		return commandError(dstErr, joinedArgs, dstStderr.String())
+	}
+
+	if srcErr != nil {
+		return commandError(srcErr, joinedArgs, srcStderr.String())
+	}
+
+	return nil
 }
 
 func cmdTest(arg ...string) error {
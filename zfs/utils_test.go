@@ -0,0 +1,83 @@
+package zfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fake zfs: send writes stream endlessly or once, recv fails or stores
+// the stream in the directory of the script
+const fakeZfsPipeScript = `#!/bin/sh
+state=$(dirname "$0")
+case "$1" in
+send) if [ "$2" = "-endless" ]; then exec yes stream; fi; echo stream ;;
+recv) if [ "$2" = "-fail" ]; then echo "cannot receive: out of space" >&2; exit 1; fi
+	cat > "$state/received" ;;
+esac
+`
+
+func fakeZfs(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "zfs-pipe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "zfs"), []byte(fakeZfsPipeScript), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+
+	return dir, func() {
+		os.Setenv("PATH", path)
+		os.RemoveAll(dir)
+	}
+}
+
+// runZfsPipe - cmdZfsPipe, which must not hang
+func runZfsPipe(t *testing.T, srcArgs, dstArgs []string) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- cmdZfsPipe(srcArgs, dstArgs)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(10 * time.Second):
+		t.Fatalf("%v | %v: not finished", srcArgs, dstArgs)
+	}
+	return nil
+}
+
+func TestCmdZfsPipe(t *testing.T) {
+	dir, restore := fakeZfs(t)
+	defer restore()
+
+	if err := runZfsPipe(t, []string{"send"}, []string{"recv"}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "received"))
+	if err != nil || strings.TrimSpace(string(data)) != "stream" {
+		t.Errorf("received %q, %v", data, err)
+	}
+}
+
+func TestCmdZfsPipeReceiveFails(t *testing.T) {
+	_, restore := fakeZfs(t)
+	defer restore()
+
+	err := runZfsPipe(t, []string{"send", "-endless"}, []string{"recv", "-fail"})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	if !strings.Contains(err.Error(), "out of space") {
+		t.Errorf("error %q, expected receive error", err.Error())
+	}
+}
@@ -1,13 +1,15 @@
 package zfs
 
 import (
+	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 )
 
 // List datasets starting from the BaseDsPath (ex: tank/nfs )
 func ListDatasets(datasetType, baseDsPath string, recursive bool, depth uint64) ([]*Dataset, error) {
-	args := []string{"list", "-H", "-t", datasetType, "-o", "name"}
+	args := []string{"list", "-Hp", "-t", datasetType, "-o", "name"}
 
 	if recursive {
 		// append "-r" argument if recursive is specified
@@ -43,6 +45,44 @@ func ListDatasets(datasetType, baseDsPath string, recursive bool, depth uint64)
 	return dataset, nil
 }
 
+// ListDatasetProps - list datasets starting from the BaseDsPath together with
+// requested properties. Every entry holds dataset name under the "name" key.
+func ListDatasetProps(datasetType, baseDsPath string, recursive bool, depth uint64, props ...string) ([]map[string]string, error) {
+	columns := append([]string{"name"}, props...)
+	args := []string{"list", "-Hp", "-t", datasetType, "-o", strings.Join(columns, ",")}
+
+	if recursive {
+		args = append(args, "-r")
+	}
+
+	if depth > 0 {
+		args = append(args, []string{"-d", strconv.FormatUint(depth, 10)}...)
+	}
+
+	if baseDsPath != "" {
+		args = append(args, baseDsPath)
+	}
+
+	out, err := cmdZfs(args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var datasets []map[string]string
+
+	for _, data := range out {
+		entry := make(map[string]string)
+		for i, column := range columns {
+			if i < len(data) {
+				entry[column] = data[i]
+			}
+		}
+		datasets = append(datasets, entry)
+	}
+	return datasets, nil
+}
+
 // Get dataset
 func GetDataset(dataset string) (*Dataset, error) {
 	datasets, err := ListDatasets("all", dataset, false, 0)
@@ -53,23 +93,26 @@ func GetDataset(dataset string) (*Dataset, error) {
 	return datasets[0], nil
 }
 
+// CreateVolumeWithProps - create volume of the specified size.
+// Thin volumes are created without reservation (sparse).
+func CreateVolumeWithProps(datasetName string, props PropertyMap, thin bool, size uint64) (*Dataset, error) {
+	return createDataset(datasetName, append(volumeArgs(thin, size), props.args()...))
+}
+
 // Create Volume
+//
+// Deprecated: options containing spaces are split. Use CreateVolumeWithProps.
 func CreateVolume(datasetName, options string, thin bool, size uint64) (*Dataset, error) {
+	return createDataset(datasetName, append(volumeArgs(thin, size), splitOptions(options)...))
+}
+
+func volumeArgs(thin bool, size uint64) []string {
 	args := []string{"-V", strconv.FormatUint(size, 10)}
 
 	if thin {
 		args = append(args, "-s")
 	}
-
-	if options != "" {
-		args = append(args, options)
-	}
-
-	ds, err := CreateDataset(datasetName, strings.Join(args, " "))
-	if err != nil {
-		return nil, err
-	}
-	return ds, nil
+	return args
 }
 
 // Is Dataset Exists
@@ -78,30 +121,37 @@ func IsDatasetExist(datasetName string) error {
 	return cmdTest(args...)
 }
 
+// CreateFilesystemWithProps - create filesystem limited by quota
+func CreateFilesystemWithProps(dataset string, props PropertyMap, size uint64) (*Dataset, error) {
+	return createDataset(dataset, append(quotaArgs(size), props.args()...))
+}
+
 // Create Filesystem
+//
+// Deprecated: options containing spaces are split. Use CreateFilesystemWithProps.
 func CreateFilesystem(dataset, options string, size uint64) (*Dataset, error) {
-	args := []string{"-o quota=" + strconv.FormatUint(size, 10)}
+	return createDataset(dataset, append(quotaArgs(size), splitOptions(options)...))
+}
 
-	if options != "" {
-		args = append(args, options)
-	}
+func quotaArgs(size uint64) []string {
+	return []string{"-o", "quota=" + strconv.FormatUint(size, 10)}
+}
 
-	ds, err := CreateDataset(dataset, strings.Join(args, " "))
-	if err != nil {
-		return nil, err
-	}
-	return ds, nil
+// CloneWithProps - create dataset from snapshot (clone dataset)
+func CloneWithProps(snapshot, clone string, props PropertyMap) (*Dataset, error) {
+	return cloneSnapshot(snapshot, clone, props.args())
 }
 
 // Create dataset from snapshot (clone dataset)
+//
+// Deprecated: options containing spaces are split. Use CloneWithProps.
 func CreateFromSnapshot(snapshot, clone, options string) (*Dataset, error) {
-	args := []string{"clone"}
+	return cloneSnapshot(snapshot, clone, splitOptions(options))
+}
 
-	// add options, for ex: -o mountpoint=/mnt/a -o recordsize=8192
-	if options != "" {
-		optionList := strings.Split(strings.TrimSpace(options), " ")
-		args = append(args, optionList...)
-	}
+func cloneSnapshot(snapshot, clone string, options []string) (*Dataset, error) {
+	args := []string{"clone"}
+	args = append(args, options...)
 
 	// append filesystem name
 	args = append(args, snapshot, clone)
@@ -119,16 +169,21 @@ func CreateFromSnapshot(snapshot, clone, options string) (*Dataset, error) {
 	return ds, nil
 }
 
+// CreateDatasetWithProps - create filesystem with properties
+func CreateDatasetWithProps(dataset string, props PropertyMap) (*Dataset, error) {
+	return createDataset(dataset, props.args())
+}
+
 // Create dataset
+//
+// Deprecated: options containing spaces are split. Use CreateDatasetWithProps.
 func CreateDataset(dataset, options string) (*Dataset, error) {
-	args := []string{"create"}
-
-	// add options, for ex: -o mountpoint=/mnt/a -o recordsize=8192
-	if options != "" {
-		optionList := strings.Split(strings.TrimSpace(options), " ")
-		args = append(args, optionList...)
-	}
+	return createDataset(dataset, splitOptions(options))
+}
 
+func createDataset(dataset string, options []string) (*Dataset, error) {
+	args := []string{"create"}
+	args = append(args, options...)
 	args = append(args, dataset)
 
 	_, err := cmdZfs(args...)
@@ -144,6 +199,48 @@ func CreateDataset(dataset, options string) (*Dataset, error) {
 	return ds, nil
 }
 
+// args - "-o name=value" arguments sorted by property name.
+// Each value is a separate argument, so it may contain spaces.
+func (props PropertyMap) args() []string {
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	args := []string{}
+	for _, name := range names {
+		args = append(args, "-o", name+"="+props[name])
+	}
+	return args
+}
+
+// args - zfs destroy flags
+func (flags DestroyFlags) args() []string {
+	args := []string{}
+	if flags.Recursive {
+		args = append(args, "-r")
+	}
+	if flags.Dependents {
+		args = append(args, "-R")
+	}
+	if flags.Force {
+		args = append(args, "-f")
+	}
+	if flags.Defer {
+		args = append(args, "-d")
+	}
+	return args
+}
+
+// splitOptions - split space separated options, for ex: -o mountpoint=/mnt/a -o recordsize=8192
+func splitOptions(options string) []string {
+	if strings.TrimSpace(options) == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSpace(options), " ")
+}
+
 // Share NFS
 func (dataset *Dataset) ShareNfs(ro, rw, root string) error {
 	args := []string{}
@@ -217,14 +314,22 @@ func (dataset *Dataset) UnshareNfs() error {
 /*
 Dataset methods
 */
+
+// DestroyWithFlags - destroy dataset
+func (dataset *Dataset) DestroyWithFlags(flags DestroyFlags) error {
+	return dataset.destroy(flags.args())
+}
+
+// Destroy - destroy dataset with space separated options, for ex: -fnpRrv
+//
+// Deprecated: use DestroyWithFlags.
 func (dataset *Dataset) Destroy(options string) error {
-	args := []string{"destroy"}
+	return dataset.destroy(splitOptions(options))
+}
 
-	// add options, for ex: -fnpRrv filesystem|volume|snapshot
-	if options != "" {
-		optionList := strings.Split(strings.TrimSpace(options), " ")
-		args = append(args, optionList...)
-	}
+func (dataset *Dataset) destroy(options []string) error {
+	args := []string{"destroy"}
+	args = append(args, options...)
 
 	// append filesystem name
 	args = append(args, dataset.Dataset)
@@ -304,9 +409,26 @@ func (dataset *Dataset) Snapshot(snapname string) (*Dataset, error) {
 	return ds, err
 }
 
+// SendRecv - replicate snapshot with all preceding snapshots and properties
+// into the target dataset (zfs send -R | zfs recv -F).
+// If fromSnapshot is specified incremental stream is sent.
+func (dataset *Dataset) SendRecv(target, fromSnapshot string) error {
+	sendArgs := []string{"send", "-R"}
+
+	if fromSnapshot != "" {
+		sendArgs = append(sendArgs, "-i", fromSnapshot)
+	}
+
+	sendArgs = append(sendArgs, dataset.Dataset)
+
+	recvArgs := []string{"recv", "-F", target}
+
+	return cmdZfsPipe(sendArgs, recvArgs)
+}
+
 // fill dataset properties
 func (dataset *Dataset) RefreshProps() error {
-	args := []string{"get", "-Hp", "-o", "property,value", "all"}
+	args := []string{"get", "-Hp", "-o", "property,value,source", "all"}
 	args = append(args, dataset.Dataset)
 
 	out, err := cmdZfs(args...)
@@ -315,34 +437,30 @@ func (dataset *Dataset) RefreshProps() error {
 		return err
 	}
 
-	dict := make(map[string]string)
+	props, err := parseProperties(out)
+	if err != nil {
+		return err
+	}
 
-	for j := range out {
-		if out[j][0] == "custom:alias" {
-			dict["alias"] = out[j][1]
-			continue
-		}
+	dict := make(map[string]string)
 
-		switch out[j][0] {
+	for name, prop := range props {
+		switch name {
 		case "custom:alias":
-			dict["alias"] = out[j][1]
+			dict["alias"] = prop.Value
 			continue
 		case "custom:sflag":
-			dict["sflag"] = out[j][1]
+			dict["sflag"] = prop.Value
 			continue
 		}
 
 		// BUGS: If snapshot have not clones, it's reported "" value, instead of "none"
 		// Not implemented in Oracle Solaris
-		if out[j][0] == "clones" {
-			if len(out[j]) <= 1 {
-				dict[out[j][0]] = "none"
-			} else {
-				dict[out[j][0]] = out[j][1]
-			}
+		if name == "clones" && prop.Value == "" {
+			dict[name] = "none"
 			continue
 		}
-		dict[out[j][0]] = out[j][1]
+		dict[name] = prop.Value
 	}
 
 	switch dict["type"] {
@@ -359,9 +477,47 @@ func (dataset *Dataset) RefreshProps() error {
 		return err
 	}
 
+	dataset.Properties = props
+
 	return nil
 }
 
+// parseProperties - parse `zfs get -H -o property,value,source` output
+func parseProperties(out [][]string) (Properties, error) {
+	props := make(Properties)
+
+	for _, line := range out {
+		if len(line) != 3 {
+			return nil, &Error{
+				Err:    fmt.Errorf("Unexpected zfs get output: %d columns, 3 expected", len(line)),
+				Debug:  strings.Join(line, "\t"),
+				Stderr: "",
+			}
+		}
+
+		source, inheritedFrom := parseSource(line[2])
+		props[line[0]] = Property{
+			Value:         line[1],
+			Source:        source,
+			InheritedFrom: inheritedFrom,
+		}
+	}
+
+	return props, nil
+}
+
+// parseSource - split "inherited from <dataset>" source.
+// Properties without source (ex: read-only) are reported as "-".
+func parseSource(source string) (string, string) {
+	switch {
+	case strings.HasPrefix(source, "inherited from "):
+		return SourceInherited, strings.TrimPrefix(source, "inherited from ")
+	case source == "-" || source == "":
+		return SourceNone, ""
+	}
+	return source, ""
+}
+
 func (dataset *Dataset) SetProp(parameter string, value interface{}) error {
 
 	options := ""
@@ -380,3 +536,15 @@ func (dataset *Dataset) SetProp(parameter string, value interface{}) error {
 
 	return nil
 }
+
+// InheritProp - clear local property value (zfs inherit)
+func (dataset *Dataset) InheritProp(parameter string) error {
+	args := []string{"inherit", parameter, dataset.Dataset}
+
+	_, err := cmdZfs(args...)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,359 @@
+package zfs
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// zpool list columns, order matters
+var poolListColumns = []string{"name", "size", "alloc", "free", "frag", "cap", "health", "dedupratio"}
+
+// ListPools - list imported zfs pools
+func ListPools() ([]*Pool, error) {
+	args := []string{"list", "-Hp", "-o", strings.Join(poolListColumns, ",")}
+
+	out, err := cmdZpool(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return parsePoolList(out)
+}
+
+// GetPool - get specified zfs pool
+func GetPool(name string) (*Pool, error) {
+	args := []string{"list", "-Hp", "-o", strings.Join(poolListColumns, ","), name}
+
+	out, err := cmdZpool(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	pools, err := parsePoolList(out)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pools) == 0 {
+		return nil, &Error{
+			Err:    errors.New("Pool not found"),
+			Kind:   KindNotFound,
+			Debug:  "pool: " + name,
+			Stderr: "",
+		}
+	}
+	return pools[0], nil
+}
+
+// Scrub - start or resume scrub of the pool
+func (pool *Pool) Scrub() error {
+	_, err := cmdZpool("scrub", pool.Name)
+	return err
+}
+
+// PauseScrub - pause scrub in progress
+func (pool *Pool) PauseScrub() error {
+	_, err := cmdZpool("scrub", "-p", pool.Name)
+	return err
+}
+
+// CancelScrub - stop scrub in progress
+func (pool *Pool) CancelScrub() error {
+	_, err := cmdZpool("scrub", "-s", pool.Name)
+	return err
+}
+
+// Clear - clear device errors of the pool
+func (pool *Pool) Clear() error {
+	_, err := cmdZpool("clear", pool.Name)
+	return err
+}
+
+// Trim - start trim of the pool devices
+func (pool *Pool) Trim() error {
+	_, err := cmdZpool("trim", pool.Name)
+	return err
+}
+
+// GetPoolStatus - get pool health and vdev tree (zpool status)
+func GetPoolStatus(name string) (*PoolStatus, error) {
+	c := command{Command: "zpool"}
+	out, err := c.Output("status", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return parsePoolStatus(out)
+}
+
+// parsePoolList - parse `zpool list -Hp -o name,size,alloc,free,frag,cap,health,dedupratio` output
+func parsePoolList(out [][]string) ([]*Pool, error) {
+	var pools []*Pool
+
+	for _, line := range out {
+		if len(line) == 0 {
+			continue
+		}
+
+		if len(line) != len(poolListColumns) {
+			return nil, &Error{
+				Err:    fmt.Errorf("Unexpected zpool list output: %d columns, %d expected", len(line), len(poolListColumns)),
+				Debug:  strings.Join(line, " "),
+				Stderr: "",
+			}
+		}
+
+		pool := &Pool{
+			Name:   line[0],
+			Health: line[6],
+		}
+
+		for i, field := range []*uint64{&pool.Size, &pool.Allocated, &pool.Free, &pool.Fragmentation, &pool.Capacity} {
+			if err := setUint(field, strings.TrimSuffix(line[i+1], "%")); err != nil {
+				return nil, &Error{
+					Err:    err,
+					Debug:  fmt.Sprintf("column %s: %s", poolListColumns[i+1], line[i+1]),
+					Stderr: "",
+				}
+			}
+		}
+
+		if line[7] != "-" {
+			dedupRatio, err := strconv.ParseFloat(strings.TrimSuffix(line[7], "x"), 64)
+			if err != nil {
+				return nil, &Error{
+					Err:    err,
+					Debug:  "column dedupratio: " + line[7],
+					Stderr: "",
+				}
+			}
+			pool.DedupRatio = dedupRatio
+		}
+
+		pools = append(pools, pool)
+	}
+	return pools, nil
+}
+
+// parsePoolStatus - parse `zpool status <pool>` output.
+// Vdev hierarchy is restored from indentation of the config section.
+func parsePoolStatus(out string) (*PoolStatus, error) {
+	status := &PoolStatus{}
+
+	var field *string
+	inConfig := false
+	baseIndent := -1
+	var stack []*Vdev
+
+	for _, line := range strings.Split(out, "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		if inConfig {
+			// config section ends with the next "key:" line
+			if trimmed != "" && !strings.HasPrefix(line, "\t") && !strings.HasPrefix(line, " ") {
+				inConfig = false
+			} else {
+				if trimmed == "" {
+					continue
+				}
+
+				indent := len(line) - len(strings.TrimLeft(line, " \t"))
+				fields := strings.Fields(trimmed)
+
+				if baseIndent < 0 {
+					if fields[0] != "NAME" {
+						return nil, &Error{
+							Err:    errors.New("Unexpected zpool status config header"),
+							Debug:  line,
+							Stderr: "",
+						}
+					}
+					baseIndent = indent
+					continue
+				}
+
+				level := (indent - baseIndent) / 2
+				if level < 0 || level > len(stack) {
+					return nil, &Error{
+						Err:    errors.New("Unexpected zpool status config indentation"),
+						Debug:  line,
+						Stderr: "",
+					}
+				}
+
+				vdev := newVdev(fields)
+				stack = stack[:level]
+				if level == 0 {
+					status.Config = append(status.Config, vdev)
+				} else {
+					parent := stack[level-1]
+					parent.Children = append(parent.Children, vdev)
+				}
+				stack = append(stack, vdev)
+				continue
+			}
+		}
+
+		if trimmed == "" {
+			field = nil
+			continue
+		}
+
+		key, value := splitStatusLine(trimmed)
+
+		// continuation of multiline value
+		if key == "" || (strings.HasPrefix(line, "\t") && field != nil) {
+			if field != nil {
+				*field = strings.TrimSpace(*field + " " + trimmed)
+			}
+			continue
+		}
+
+		field = nil
+		switch key {
+		case "pool":
+			status.Name = value
+		case "state":
+			status.State = value
+		case "status":
+			status.Status = value
+			field = &status.Status
+		case "action":
+			status.Action = value
+			field = &status.Action
+		case "see":
+			status.See = value
+		case "scan", "scrub":
+			status.Scan = value
+			field = &status.Scan
+		case "errors":
+			status.Errors = value
+			field = &status.Errors
+		case "config":
+			inConfig = true
+		}
+	}
+
+	if status.Name == "" {
+		return nil, &Error{
+			Err:    errors.New("Unexpected zpool status output: pool name not found"),
+			Debug:  out,
+			Stderr: "",
+		}
+	}
+
+	status.ScanStatus = parseScanStatus(status.Scan)
+	return status, nil
+}
+
+// parseScanStatus - parse scan line of zpool status, ex:
+//   - none requested
+//   - scrub in progress since Sun Oct 18 01:00:00 2026 ... 40.00% done
+//   - scrub repaired 0 in 1h2m with 0 errors on Sun Oct 18 03:02:11 2026
+//   - scrub canceled on Sun Oct 18 01:10:00 2026
+//   - scrub paused since Sun Oct 18 01:10:00 2026
+//   - resilvered 1.2G in 0h5m with 0 errors on Sun Oct 18 03:02:11 2026
+func parseScanStatus(scan string) *ScanStatus {
+	status := &ScanStatus{State: ScanStateNone, Raw: scan}
+
+	fields := strings.Fields(scan)
+	if len(fields) == 0 || scan == "none requested" {
+		return status
+	}
+
+	switch {
+	case strings.HasPrefix(fields[0], "resilver"):
+		status.Function = "resilver"
+	case fields[0] == "scrub":
+		status.Function = "scrub"
+	}
+
+	// fields following the word
+	after := func(word string) []string {
+		for i, field := range fields {
+			if field == word && i+1 < len(fields) {
+				return fields[i+1:]
+			}
+		}
+		return nil
+	}
+
+	// date is printed in ctime format: Sun Oct 18 03:02:11 2026
+	date := func(word string) string {
+		value := after(word)
+		if len(value) > 5 {
+			value = value[:5]
+		}
+		return strings.Join(value, " ")
+	}
+
+	first := func(value []string) string {
+		if len(value) == 0 {
+			return ""
+		}
+		return value[0]
+	}
+
+	switch {
+	case strings.Contains(scan, "in progress since"):
+		status.State = ScanStateInProgress
+		status.Time = date("since")
+		for i, field := range fields {
+			if field == "done" && i > 0 && strings.HasSuffix(fields[i-1], "%") {
+				status.Progress, _ = strconv.ParseFloat(strings.TrimSuffix(fields[i-1], "%"), 64)
+			}
+		}
+	case strings.Contains(scan, "paused since"):
+		status.State = ScanStatePaused
+		status.Time = date("since")
+	case strings.Contains(scan, "canceled on"):
+		status.State = ScanStateCanceled
+		status.Time = date("on")
+	case strings.Contains(scan, " with ") && strings.Contains(scan, " errors on "):
+		status.State = ScanStateFinished
+		status.Progress = 100
+		status.Time = date("on")
+		status.Errors = first(after("with"))
+		if status.Function == "scrub" {
+			status.Repaired = first(after("repaired"))
+		} else {
+			status.Repaired = first(after("resilvered"))
+		}
+	default:
+		status.State = ScanStateUnknown
+	}
+
+	return status
+}
+
+// splitStatusLine - split "key: value" line of zpool status output
+func splitStatusLine(line string) (string, string) {
+	i := strings.Index(line, ":")
+	if i <= 0 || strings.ContainsAny(line[:i], " \t") {
+		return "", line
+	}
+	return line[:i], strings.TrimSpace(line[i+1:])
+}
+
+// newVdev - create vdev from config line: NAME STATE READ WRITE CKSUM [message].
+// Group lines (logs, cache, spares) have name only, spares have name and state.
+func newVdev(fields []string) *Vdev {
+	vdev := &Vdev{Name: fields[0]}
+
+	if len(fields) > 1 {
+		vdev.State = fields[1]
+	}
+
+	if len(fields) > 4 {
+		vdev.Read = fields[2]
+		vdev.Write = fields[3]
+		vdev.Checksum = fields[4]
+	}
+
+	if len(fields) > 5 {
+		vdev.Message = strings.Join(fields[5:], " ")
+	}
+	return vdev
+}
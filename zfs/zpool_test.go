@@ -0,0 +1,198 @@
+package zfs
+
+import (
+	"strings"
+	"testing"
+)
+
+// captured `zpool list -Hp -o name,size,alloc,free,frag,cap,health,dedupratio`
+const zpoolListOutput = "rpool\t21206401024\t8415481856\t12790919168\t31%\t39\tONLINE\t1.00x\n" +
+	"tank\t1992864825344\t543313362944\t1449551462400\t-\t27\tDEGRADED\t1.35x\n"
+
+// captured `zpool status tank`
+const zpoolStatusOutput = `  pool: tank
+ state: DEGRADED
+status: One or more devices has been taken offline by the administrator.
+	Sufficient replicas exist for the pool to continue functioning in a
+	degraded state.
+action: Online the device using 'zpool online' or replace the device with
+	'zpool replace'.
+  scan: scrub repaired 0 in 1h2m with 0 errors on Sun Oct 18 03:02:11 2026
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	tank        DEGRADED     0     0     0
+	  mirror-0  DEGRADED     0     0     0
+	    c1t0d0  ONLINE       0     0     0
+	    c1t1d0  OFFLINE      0     0     0
+	  mirror-1  ONLINE       0     0     0
+	    c1t2d0  ONLINE       0     0     0
+	    c1t3d0  ONLINE       0     0    12  too many errors
+	logs
+	  c2t0d0    ONLINE       0     0     0
+	cache
+	  c2t1d0    ONLINE       0     0     0
+	spares
+	  c3t0d0    AVAIL
+
+errors: No known data errors
+`
+
+func splitOutput(out string) [][]string {
+	lines := strings.Split(out, "\n")
+	lines = lines[0 : len(lines)-1]
+
+	output := make([][]string, len(lines))
+	for i, line := range lines {
+		output[i] = strings.Fields(line)
+	}
+	return output
+}
+
+func TestParsePoolList(t *testing.T) {
+	pools, err := parsePoolList(splitOutput(zpoolListOutput))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(pools) != 2 {
+		t.Fatalf("expected 2 pools, got %d", len(pools))
+	}
+
+	rpool := pools[0]
+	if rpool.Name != "rpool" || rpool.Size != 21206401024 || rpool.Allocated != 8415481856 ||
+		rpool.Free != 12790919168 || rpool.Fragmentation != 31 || rpool.Capacity != 39 ||
+		rpool.Health != "ONLINE" || rpool.DedupRatio != 1.0 {
+		t.Fatalf("unexpected pool: %+v", *rpool)
+	}
+
+	tank := pools[1]
+	if tank.Fragmentation != 0 || tank.Health != "DEGRADED" || tank.DedupRatio != 1.35 {
+		t.Fatalf("unexpected pool: %+v", *tank)
+	}
+}
+
+func TestParsePoolListUnexpectedColumns(t *testing.T) {
+	_, err := parsePoolList([][]string{{"tank", "1024"}})
+	if err == nil {
+		t.Fatal("expected error on truncated zpool list output")
+	}
+}
+
+func TestParsePoolStatus(t *testing.T) {
+	status, err := parsePoolStatus(zpoolStatusOutput)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if status.Name != "tank" || status.State != "DEGRADED" {
+		t.Fatalf("unexpected pool status: %+v", *status)
+	}
+
+	if status.Status != "One or more devices has been taken offline by the administrator. "+
+		"Sufficient replicas exist for the pool to continue functioning in a degraded state." {
+		t.Fatalf("unexpected status: %q", status.Status)
+	}
+
+	if status.Action != "Online the device using 'zpool online' or replace the device with 'zpool replace'." {
+		t.Fatalf("unexpected action: %q", status.Action)
+	}
+
+	if !strings.HasPrefix(status.Scan, "scrub repaired 0") {
+		t.Fatalf("unexpected scan: %q", status.Scan)
+	}
+
+	if status.ScanStatus.State != ScanStateFinished {
+		t.Fatalf("unexpected scan status: %+v", *status.ScanStatus)
+	}
+
+	if status.Errors != "No known data errors" {
+		t.Fatalf("unexpected errors: %q", status.Errors)
+	}
+
+	if len(status.Config) != 4 {
+		t.Fatalf("expected 4 top level entries, got %d", len(status.Config))
+	}
+
+	root := status.Config[0]
+	if root.Name != "tank" || len(root.Children) != 2 {
+		t.Fatalf("unexpected root vdev: %+v", *root)
+	}
+
+	mirror := root.Children[1]
+	if mirror.Name != "mirror-1" || len(mirror.Children) != 2 {
+		t.Fatalf("unexpected mirror vdev: %+v", *mirror)
+	}
+
+	disk := mirror.Children[1]
+	if disk.Name != "c1t3d0" || disk.Checksum != "12" || disk.Message != "too many errors" {
+		t.Fatalf("unexpected disk vdev: %+v", *disk)
+	}
+
+	if root.Children[0].Children[1].State != "OFFLINE" {
+		t.Fatalf("unexpected disk vdev: %+v", *root.Children[0].Children[1])
+	}
+
+	for i, group := range []string{"logs", "cache", "spares"} {
+		vdev := status.Config[i+1]
+		if vdev.Name != group || len(vdev.Children) != 1 {
+			t.Fatalf("unexpected %s group: %+v", group, *vdev)
+		}
+	}
+
+	spare := status.Config[3].Children[0]
+	if spare.Name != "c3t0d0" || spare.State != "AVAIL" || spare.Read != "" {
+		t.Fatalf("unexpected spare: %+v", *spare)
+	}
+}
+
+func TestParsePoolStatusEmpty(t *testing.T) {
+	_, err := parsePoolStatus("")
+	if err == nil {
+		t.Fatal("expected error on empty zpool status output")
+	}
+}
+
+func TestParseScanStatus(t *testing.T) {
+	tests := []struct {
+		scan     string
+		expected ScanStatus
+	}{
+		{
+			scan:     "none requested",
+			expected: ScanStatus{State: ScanStateNone},
+		},
+		{
+			scan: "scrub in progress since Sun Oct 18 01:00:00 2026 " +
+				"1.2G scanned out of 3G at 10M/s, 0h2m to go 0 repaired, 40.00% done",
+			expected: ScanStatus{Function: "scrub", State: ScanStateInProgress, Progress: 40,
+				Time: "Sun Oct 18 01:00:00 2026"},
+		},
+		{
+			scan:     "scrub paused since Sun Oct 18 01:10:00 2026 scrub started on Sun Oct 18 01:00:00 2026",
+			expected: ScanStatus{Function: "scrub", State: ScanStatePaused, Time: "Sun Oct 18 01:10:00 2026"},
+		},
+		{
+			scan:     "scrub canceled on Sun Oct 18 01:10:00 2026",
+			expected: ScanStatus{Function: "scrub", State: ScanStateCanceled, Time: "Sun Oct 18 01:10:00 2026"},
+		},
+		{
+			scan: "scrub repaired 0 in 1h2m with 3 errors on Sun Oct 18 03:02:11 2026",
+			expected: ScanStatus{Function: "scrub", State: ScanStateFinished, Progress: 100,
+				Repaired: "0", Errors: "3", Time: "Sun Oct 18 03:02:11 2026"},
+		},
+		{
+			scan: "resilvered 1.2G in 0h5m with 0 errors on Sun Oct 18 03:02:11 2026",
+			expected: ScanStatus{Function: "resilver", State: ScanStateFinished, Progress: 100,
+				Repaired: "1.2G", Errors: "0", Time: "Sun Oct 18 03:02:11 2026"},
+		},
+	}
+
+	for _, test := range tests {
+		status := parseScanStatus(test.scan)
+		test.expected.Raw = test.scan
+		if *status != test.expected {
+			t.Errorf("scan %q: expected %+v, got %+v", test.scan, test.expected, *status)
+		}
+	}
+}
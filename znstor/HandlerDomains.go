@@ -0,0 +1,210 @@
+package znstor
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/d-helios/znstord/zfs"
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/copier"
+)
+
+// List domains across non private pools
+func HandlerGetDomainList(w http.ResponseWriter, r *http.Request) {
+	params, err := parseListParams(r, listSortName)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	namePrefix := params.Query.Get("name_prefix")
+
+	domains, err := listDomains()
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	var items []listItem
+	for _, domain := range domains {
+		if !strings.HasPrefix(domain.Domain, namePrefix) {
+			continue
+		}
+
+		items = append(items, listItem{
+			Key:   domain.Domain,
+			Name:  domain.Domain,
+			Value: domain,
+		})
+	}
+
+	page, err := paginate(w, items, params)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(page)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+	}
+}
+
+// Get domain with its datasets on every pool
+func HandlerGetDomain(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	domainName := vars["domain"]
+
+	domains, err := listDomains()
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	for _, domain := range domains {
+		if domain.Domain != domainName {
+			continue
+		}
+
+		err = json.NewEncoder(w).Encode(domain)
+		if err != nil {
+			sendError(w, traceFunctionName(), err)
+		}
+		return
+	}
+
+	sendCodedMessage(w, http.StatusNotFound, traceFunctionName(), codeNotFound, "Domain not found")
+}
+
+// Create domain on specified pool.
+// Quota, reservation and properties of the domain are inherited by projects
+func HandlerCreateDomain(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	domainName := vars["domain"]
+	poolName := vars["pool"]
+	basepath := poolName + "/" + domainName
+
+	var zfsOptions FilesystemRequest
+	err := decodeRequest(r, &zfsOptions, requestPayloadMaxSize)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	props := filesystemCreateProps(zfsOptions)
+
+	unlock := locks.Lock(domainLockKey(basepath))
+	dataset, err := zfs.CreateFilesystemWithProps(basepath, props, zfsOptions.Quota)
+	unlock()
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	domainPool := DomainPool{Pool: poolName}
+
+	dataset.RefreshProps()
+	copier.Copy(&domainPool.Options, dataset.Props.(*zfs.FsDataset))
+
+	err = json.NewEncoder(w).Encode(Domain{Domain: domainName, Pools: []DomainPool{domainPool}})
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+}
+
+// Destroy domain on specified pool. Domain with projects could not be destroyed
+func HandlerDestroyDomain(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	domainName := vars["domain"]
+	poolName := vars["pool"]
+	basepath := poolName + "/" + domainName
+
+	// projects can't be created while domain is checked and destroyed
+	unlock := locks.Lock(domainLockKey(basepath))
+	defer unlock()
+
+	dataset, err := zfs.GetDataset(basepath)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	children, err := zfs.ListDatasets(zfs.Filesystem+","+zfs.Volume, basepath, true, 1)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	// listing includes domain dataset itself
+	if len(children) > 1 {
+		sendCodedMessage(w, http.StatusConflict, traceFunctionName(), codeNotEmpty, "Domain is not empty. Destroy projects first")
+		return
+	}
+
+	err = dataset.DestroyWithFlags(zfs.DestroyFlags{})
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	sendMessage(w, http.StatusOK, traceFunctionName(), "")
+}
+
+// listDomains - collect domain datasets of non private pools, grouped by domain name
+func listDomains() ([]*Domain, error) {
+	pools, err := zfs.ListPools()
+	if err != nil {
+		return nil, err
+	}
+
+	var domains []*Domain
+	domainsByName := make(map[string]*Domain)
+
+	for _, pool := range pools {
+		if isPrivatePool(pool.Name) {
+			continue
+		}
+
+		datasets, err := zfs.ListDatasets(zfs.Filesystem, pool.Name, true, 2)
+		if err != nil {
+			return nil, err
+		}
+
+		projects := make(map[string]int)
+		var domainDatasets []*zfs.Dataset
+
+		for _, dataset := range datasets {
+			switch strings.Count(dataset.Dataset, "/") {
+			case 1:
+				domainDatasets = append(domainDatasets, dataset)
+			case 2:
+				projects[path.Dir(dataset.Dataset)]++
+			}
+		}
+
+		for _, dataset := range domainDatasets {
+			if err := dataset.RefreshProps(); err != nil {
+				return nil, err
+			}
+
+			domainPool := DomainPool{
+				Pool:     pool.Name,
+				Projects: projects[dataset.Dataset],
+			}
+			copier.Copy(&domainPool.Options, dataset.Props.(*zfs.FsDataset))
+
+			name := path.Base(dataset.Dataset)
+			domain, ok := domainsByName[name]
+			if !ok {
+				domain = &Domain{Domain: name}
+				domainsByName[name] = domain
+				domains = append(domains, domain)
+			}
+			domain.Pools = append(domain.Pools, domainPool)
+		}
+	}
+	return domains, nil
+}
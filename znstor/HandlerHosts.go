@@ -5,21 +5,27 @@ import (
 	"github.com/d-helios/znstord/stmf"
 	"github.com/gorilla/mux"
 	"net/http"
+	"strings"
 )
 
 func HandlerCreateHostGroup(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	hostgroupName := vars["hostgroup"]
 
+	unlock := locks.Lock(hostGroupLockKey(hostgroupName))
+	defer unlock()
+
+	unlockComstar := locks.LockComstar()
 	hostgroup, err := stmf.CreateHostGroup(hostgroupName)
+	unlockComstar()
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	err = json.NewEncoder(w).Encode(hostgroup)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 	}
 }
 
@@ -29,35 +35,128 @@ func HandlerGetHostGroup(w http.ResponseWriter, r *http.Request) {
 
 	hostgroup, err := stmf.GetHostGroup(hostgroupName)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	err = json.NewEncoder(w).Encode(hostgroup)
 
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+}
+
+// Get LUNs visible to host group members. "All" returns LUNs of every host group
+func HandlerGetHostGroupLunMap(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	hostgroupName := vars["hostgroup"]
+
+	if hostgroupName == hostGroupAll {
+		hostgroupName = ""
+	} else {
+		_, err := stmf.GetHostGroup(hostgroupName)
+		if err != nil {
+			sendError(w, traceFunctionName(), err)
+			return
+		}
+	}
+
+	lunMap, err := hostGroupLunMap(hostgroupName, isFresh(r))
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(lunMap)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+}
+
+// Get members of host group and every logical unit visible to them
+func HandlerGetHostGroupVisibility(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	hostgroupName := vars["hostgroup"]
+
+	visibility, err := hostGroupVisibility(hostgroupName, isFresh(r))
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(visibility)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+}
+
+// Get host groups of initiator (IQN or WWN) and every logical unit visible to it
+func HandlerGetInitiatorVisibility(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	initiatorName := vars["initiator"]
+
+	visibility, err := initiatorVisibility(initiatorName, isFresh(r))
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
+	err = json.NewEncoder(w).Encode(visibility)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
 }
 
 func HandlerGetHostGroupList(w http.ResponseWriter, r *http.Request) {
-	hostgroup, err := stmf.ListHostGroup("")
+	params, err := parseListParams(r, listSortName)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
-	if hostgroup == nil {
-		// return empty array if pointer is nil
-		err = json.NewEncoder(w).Encode([]string{})
-	} else {
-		err = json.NewEncoder(w).Encode(hostgroup)
+
+	// filters
+	namePrefix := params.Query.Get("name_prefix")
+	member := params.Query.Get("member")
+
+	hostgroups, err := stmf.ListHostGroup("")
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	var items []listItem
+	for _, hostgroup := range hostgroups {
+		if !strings.HasPrefix(hostgroup.HostGroup, namePrefix) {
+			continue
+		}
+		if member != "" && !checkOption(member, hostgroup.Members) {
+			continue
+		}
+
+		items = append(items, listItem{
+			Key:   hostgroup.HostGroup,
+			Name:  hostgroup.HostGroup,
+			Value: hostgroup,
+		})
+	}
+
+	// return empty array if there is no host groups
+	page, err := paginate(w, items, params)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
 	}
 
+	err = json.NewEncoder(w).Encode(page)
+
 	// send error Econding error
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 }
@@ -67,21 +166,26 @@ func HandlerAddHostGroupMember(w http.ResponseWriter, r *http.Request) {
 	hostgroupName := vars["hostgroup"]
 	memberName := vars["member"]
 
+	unlock := locks.Lock(hostGroupLockKey(hostgroupName))
+	defer unlock()
+
 	hostgroup, err := stmf.GetHostGroup(hostgroupName)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
+	unlockComstar := locks.LockComstar()
 	err = hostgroup.AddMember(memberName)
+	unlockComstar()
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	err = json.NewEncoder(w).Encode(hostgroup)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 }
@@ -91,21 +195,26 @@ func HandlerRemoveHostGroupMember(w http.ResponseWriter, r *http.Request) {
 	hostgroupName := vars["hostgroup"]
 	memberName := vars["member"]
 
+	unlock := locks.Lock(hostGroupLockKey(hostgroupName))
+	defer unlock()
+
 	hostgroup, err := stmf.GetHostGroup(hostgroupName)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
+	unlockComstar := locks.LockComstar()
 	err = hostgroup.RemoveMember(memberName)
+	unlockComstar()
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	err = json.NewEncoder(w).Encode(hostgroup)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 }
@@ -114,15 +223,20 @@ func HandlerDeleteHostGroup(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	hostgroupName := vars["hostgroup"]
 
+	unlock := locks.Lock(hostGroupLockKey(hostgroupName))
+	defer unlock()
+
 	hostgroup, err := stmf.GetHostGroup(hostgroupName)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
+	unlockComstar := locks.LockComstar()
 	err = hostgroup.Delete()
+	unlockComstar()
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 }
@@ -132,21 +246,26 @@ func HandlerAddMultiGroupMember(w http.ResponseWriter, r *http.Request) {
 	hostgroupName := vars["hostgroup"]
 	memberName := vars["member"]
 
+	unlock := locks.Lock(hostGroupLockKey(hostgroupName))
+	defer unlock()
+
 	hostgroup, err := stmf.GetHostGroup(hostgroupName)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
+	unlockComstar := locks.LockComstar()
 	err = hostgroup.AddMultiHostGroupMember(memberName)
+	unlockComstar()
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	err = json.NewEncoder(w).Encode(hostgroup)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 }
@@ -1 +1,186 @@
 package znstor
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/d-helios/znstord/zfs"
+	"github.com/gorilla/mux"
+)
+
+// List zfs pools. Private pools are hidden
+func HandlerGetPoolList(w http.ResponseWriter, r *http.Request) {
+	params, err := parseListParams(r, listSortName, listSortSize)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	// filters
+	namePrefix := params.Query.Get("name_prefix")
+	health := params.Query.Get("health")
+
+	pools, err := zfs.ListPools()
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	var items []listItem
+	for _, pool := range pools {
+		if isPrivatePool(pool.Name) || !strings.HasPrefix(pool.Name, namePrefix) {
+			continue
+		}
+		if health != "" && !strings.EqualFold(pool.Health, health) {
+			continue
+		}
+
+		items = append(items, listItem{
+			Key:   pool.Name,
+			Name:  pool.Name,
+			Size:  pool.Size,
+			Value: pool,
+		})
+	}
+
+	page, err := paginate(w, items, params)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(page)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+	}
+}
+
+// Get zfs pool capacity, health and vdev status
+func HandlerGetPool(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	poolName := vars["pool"]
+
+	pool, err := zfs.GetPool(poolName)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	status, err := zfs.GetPoolStatus(poolName)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(PoolInfo{Pool: *pool, Status: status})
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+	}
+}
+
+// Get progress or result of the last pool scrub
+func HandlerGetPoolScrub(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	poolName := vars["pool"]
+
+	status, err := zfs.GetPoolStatus(poolName)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(status.ScanStatus)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+	}
+}
+
+// Start or resume pool scrub. Job is finished with the scrub, final scan
+// status is the job result.
+func HandlerStartPoolScrub(w http.ResponseWriter, r *http.Request) {
+	poolMaintenanceJob(w, r, (*zfs.Pool).Scrub, waitScrub)
+}
+
+// Pause pool scrub
+func HandlerPausePoolScrub(w http.ResponseWriter, r *http.Request) {
+	poolMaintenance(w, r, (*zfs.Pool).PauseScrub)
+}
+
+// Cancel pool scrub
+func HandlerCancelPoolScrub(w http.ResponseWriter, r *http.Request) {
+	poolMaintenance(w, r, (*zfs.Pool).CancelScrub)
+}
+
+// Clear pool device errors
+func HandlerClearPool(w http.ResponseWriter, r *http.Request) {
+	poolMaintenance(w, r, (*zfs.Pool).Clear)
+}
+
+// Trim pool devices
+func HandlerTrimPool(w http.ResponseWriter, r *http.Request) {
+	poolMaintenance(w, r, (*zfs.Pool).Trim)
+}
+
+// poolMaintenance - run pool operation as async job
+func poolMaintenance(w http.ResponseWriter, r *http.Request, operation func(*zfs.Pool) error) {
+	poolMaintenanceJob(w, r, operation, nil)
+}
+
+// poolMaintenanceJob - run pool operation as async job. If wait is set, job
+// is finished when wait returns. Pool lock is held only by operation, so
+// started scrub could be paused or canceled.
+func poolMaintenanceJob(w http.ResponseWriter, r *http.Request, operation func(*zfs.Pool) error,
+	wait func(*zfs.Pool) (interface{}, error)) {
+	vars := mux.Vars(r)
+	poolName := vars["pool"]
+
+	pool, err := zfs.GetPool(poolName)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	requestUuid := startJobWithResult(func() (interface{}, error) {
+		unlock := locks.Lock(poolLockKey(pool.Name))
+		err := operation(pool)
+		unlock()
+
+		if err != nil || wait == nil {
+			return nil, err
+		}
+		return wait(pool)
+	})
+
+	log.Printf("===\n%s: pool %s, job %s\n\n", traceFunctionName(), pool.Name, requestUuid)
+	sendMessage(w, http.StatusAccepted, traceFunctionName(), requestUuid)
+}
+
+// waitScrub - poll scan status of the pool until scrub is finished.
+// Paused or canceled scrub fails the job.
+func waitScrub(pool *zfs.Pool) (interface{}, error) {
+	for {
+		status, err := zfs.GetPoolStatus(pool.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		scan := status.ScanStatus
+		switch {
+		case scan.State == zfs.ScanStateInProgress:
+			time.Sleep(scrubPollInterval)
+			continue
+		case scan.Function == "scrub" && scan.State == zfs.ScanStateFinished:
+			return scan, nil
+		}
+
+		return scan, &Error{
+			Err:    fmt.Errorf("Scrub of pool %s is not finished, last scan: %s %s", pool.Name, scan.Function, scan.State),
+			Debug:  scan.Raw,
+			Stderr: "",
+		}
+	}
+}
@@ -9,7 +9,6 @@ import (
 	"github.com/d-helios/znstord/zfs"
 	"github.com/gorilla/mux"
 	"github.com/jinzhu/copier"
-	"io"
 )
 
 // List available projects within domain
@@ -19,31 +18,63 @@ func HandlerGetProjectList(w http.ResponseWriter, r *http.Request) {
 	poolName := vars["pool"]
 	basepath := poolName + "/" + domainName
 
-	datasets, err := zfs.ListDatasets(zfs.Filesystem, basepath, true, 1)
+	params, err := parseListParams(r, listSortName, listSortSize, listSortCreation)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
-	var projects = make([]Project, 0)
+	namePrefix := params.Query.Get("name_prefix")
+
+	tags, err := parseTagFilters(params)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	datasets, err := zfs.ListDatasetProps(zfs.Filesystem, basepath, true, 1, append([]string{"used", "creation"}, tagNames(tags)...)...)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	var items []listItem
 
 	for _, dataset := range datasets {
+		// exclude domain dataset
+		if basepath == dataset["name"] {
+			continue
+		}
+
 		var project Project
 
 		// get last dataset path
 		project.Dataset = strings.Join(
-			strings.Split(dataset.Dataset, "/")[len(strings.Split(dataset.Dataset, "/"))-1:len(strings.Split(dataset.Dataset, "/"))],
+			strings.Split(dataset["name"], "/")[len(strings.Split(dataset["name"], "/"))-1:len(strings.Split(dataset["name"], "/"))],
 			"")
 
-		// exclude domain dataset
-		if basepath != dataset.Dataset {
-			projects = append(projects, project)
+		if !strings.HasPrefix(project.Dataset, namePrefix) || !matchTags(dataset, tags) {
+			continue
 		}
+
+		items = append(items, listItem{
+			Key:      project.Dataset,
+			Name:     project.Dataset,
+			Size:     parseUintProp(dataset["used"]),
+			Creation: parseUintProp(dataset["creation"]),
+			Value:    project,
+		})
+	}
+
+	projects, err := paginate(w, items, params)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
 	}
 
 	err = json.NewEncoder(w).Encode(projects)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 	return
@@ -59,7 +90,7 @@ func HandlerGetProject(w http.ResponseWriter, r *http.Request) {
 
 	dataset, err := zfs.GetDataset(basepath)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
@@ -71,10 +102,11 @@ func HandlerGetProject(w http.ResponseWriter, r *http.Request) {
 
 	dataset.RefreshProps()
 	copier.Copy(&project.Options, dataset.Props.(*zfs.FsDataset))
+	project.Properties = publicProperties(dataset.Properties)
 
 	err = json.NewEncoder(w).Encode(project)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 	return
@@ -105,45 +137,33 @@ func HandlerCreateProject(w http.ResponseWriter, r *http.Request) {
 	basepath := poolName + "/" + domainName + "/" + projectName
 
 	var zfsOptions FilesystemRequest
-	decoder := json.NewDecoder(io.LimitReader(r.Body, requestPayloadMaxSize))
-	err := decoder.Decode(&zfsOptions)
+	err := decodeRequest(r, &zfsOptions, requestPayloadMaxSize)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	// Check if quota is specified
 	if zfsOptions.Quota == 0 {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), "")
+		sendCodedMessage(w, http.StatusUnprocessableEntity, traceFunctionName(), codeInvalidArgument, "Quota not specified")
 		return
 	}
 
-	args := []string{}
-	if zfsOptions.Alias != "" {
-		args = append(args, "-o custom:alias="+zfsOptions.Alias)
-	}
-	if zfsOptions.Reservation != 0 {
-		args = append(args, "-o reservation="+strconv.FormatUint(zfsOptions.Reservation, 10))
-	}
-	if zfsOptions.Dedup != "" {
-		args = append(args, "-o dedup="+zfsOptions.Dedup)
-	}
-	if zfsOptions.Compression != "" {
-		args = append(args, "-o compression="+zfsOptions.Compression)
-	}
-	if zfsOptions.Atime != "" {
-		args = append(args, "-o atime="+zfsOptions.Atime)
-	}
-	if zfsOptions.Refquota != 0 {
-		args = append(args, "-o refquota="+strconv.FormatUint(zfsOptions.Refquota, 10))
-	}
-	if zfsOptions.Refreservation != 0 {
-		args = append(args, "-o refreservation="+strconv.FormatUint(zfsOptions.Refreservation, 10))
+	props := filesystemCreateProps(zfsOptions)
+
+	// domain can't be destroyed while project is created
+	unlock := locks.Lock(domainLockKey(poolName+"/"+domainName), projectLockKey(basepath))
+	dataset, err := zfs.CreateFilesystemWithProps(basepath, props, zfsOptions.Quota)
+	if err != nil {
+		unlock()
+		sendError(w, traceFunctionName(), err)
+		return
 	}
 
-	dataset, err := zfs.CreateFilesystem(basepath, strings.Join(args, " "), zfsOptions.Quota)
+	err = setProjectLimits(dataset, zfsOptions)
+	unlock()
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
@@ -159,11 +179,38 @@ func HandlerCreateProject(w http.ResponseWriter, r *http.Request) {
 	err = json.NewEncoder(w).Encode(project)
 
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 }
 
+// filesystemCreateProps - zfs create properties of project or domain dataset
+func filesystemCreateProps(zfsOptions FilesystemRequest) zfs.PropertyMap {
+	props := zfs.PropertyMap{}
+	if zfsOptions.Alias != "" {
+		props["custom:alias"] = zfsOptions.Alias
+	}
+	if zfsOptions.Reservation != 0 {
+		props["reservation"] = strconv.FormatUint(zfsOptions.Reservation, 10)
+	}
+	if zfsOptions.Dedup != "" {
+		props["dedup"] = zfsOptions.Dedup
+	}
+	if zfsOptions.Compression != "" {
+		props["compression"] = zfsOptions.Compression
+	}
+	if zfsOptions.Atime != "" {
+		props["atime"] = zfsOptions.Atime
+	}
+	if zfsOptions.Refquota != 0 {
+		props["refquota"] = strconv.FormatUint(zfsOptions.Refquota, 10)
+	}
+	if zfsOptions.Refreservation != 0 {
+		props["refreservation"] = strconv.FormatUint(zfsOptions.Refreservation, 10)
+	}
+	return props
+}
+
 func HandlerModifyProject(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	domainName := vars["domain"]
@@ -172,23 +219,22 @@ func HandlerModifyProject(w http.ResponseWriter, r *http.Request) {
 	basepath := poolName + "/" + domainName + "/" + projectName
 
 	var zfsOptions FilesystemRequest
-	decoder := json.NewDecoder(io.LimitReader(r.Body, requestPayloadMaxSize))
-	err := decoder.Decode(&zfsOptions)
+	err := decodeRequest(r, &zfsOptions, requestPayloadMaxSize)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	dataset, err := zfs.GetDataset(basepath)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	if zfsOptions.Alias != "" {
 		err := dataset.SetProp("custom:alias", zfsOptions.Alias)
 		if err != nil {
-			sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+			sendError(w, traceFunctionName(), err)
 			return
 		}
 	}
@@ -196,53 +242,61 @@ func HandlerModifyProject(w http.ResponseWriter, r *http.Request) {
 	if zfsOptions.Quota != 0 {
 		err := dataset.SetProp("quota", zfsOptions.Quota)
 		if err != nil {
-			sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+			sendError(w, traceFunctionName(), err)
 			return
 		}
 	}
 	if zfsOptions.Reservation != 0 {
 		err := dataset.SetProp("reservation", zfsOptions.Reservation)
 		if err != nil {
-			sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+			sendError(w, traceFunctionName(), err)
 			return
 		}
 	}
 	if zfsOptions.Dedup != "" {
 		err := dataset.SetProp("dedup", zfsOptions.Dedup)
 		if err != nil {
-			sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+			sendError(w, traceFunctionName(), err)
 			return
 		}
 	}
 	if zfsOptions.Compression != "" {
 		err := dataset.SetProp("compression", zfsOptions.Compression)
 		if err != nil {
-			sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+			sendError(w, traceFunctionName(), err)
 			return
 		}
 	}
 	if zfsOptions.Atime != "" {
 		err := dataset.SetProp("atime", zfsOptions.Atime)
 		if err != nil {
-			sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+			sendError(w, traceFunctionName(), err)
 			return
 		}
 	}
 	if zfsOptions.Refquota != 0 {
 		err := dataset.SetProp("refquota", zfsOptions.Refquota)
 		if err != nil {
-			sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+			sendError(w, traceFunctionName(), err)
 			return
 		}
 	}
 	if zfsOptions.Refreservation != 0 {
 		err := dataset.SetProp("refreservation", zfsOptions.Refreservation)
 		if err != nil {
-			sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+			sendError(w, traceFunctionName(), err)
 			return
 		}
 	}
 
+	unlock := locks.Lock(projectLockKey(basepath))
+	err = setProjectLimits(dataset, zfsOptions)
+	unlock()
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
 	var project Project
 
 	project.Dataset = strings.Join(
@@ -255,7 +309,85 @@ func HandlerModifyProject(w http.ResponseWriter, r *http.Request) {
 	err = json.NewEncoder(w).Encode(project)
 
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+}
+
+// Get project capacity report: provisioned size of volumes, used space and limits
+func HandlerGetProjectCapacity(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	domainName := vars["domain"]
+	poolName := vars["pool"]
+	projectName := vars["project"]
+	basepath := poolName + "/" + domainName + "/" + projectName
+
+	capacity, err := projectCapacity(basepath)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(capacity)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+}
+
+// Get defaults of the new project volumes
+func HandlerGetProjectDefaults(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	domainName := vars["domain"]
+	poolName := vars["pool"]
+	projectName := vars["project"]
+	basepath := poolName + "/" + domainName + "/" + projectName
+
+	defaults, err := getProjectDefaults(basepath)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(defaults)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+}
+
+// Replace defaults of the new project volumes
+func HandlerSetProjectDefaults(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	domainName := vars["domain"]
+	poolName := vars["pool"]
+	projectName := vars["project"]
+	basepath := poolName + "/" + domainName + "/" + projectName
+
+	var reqJson ProjectDefaults
+	err := decodeRequest(r, &reqJson, requestPayloadMaxSize)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	unlock := locks.Lock(projectLockKey(basepath))
+	err = setProjectDefaults(basepath, reqJson)
+	unlock()
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	defaults, err := getProjectDefaults(basepath)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(defaults)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 }
@@ -269,13 +401,13 @@ func HandlerDestroyProject(w http.ResponseWriter, r *http.Request) {
 
 	dataset, err := zfs.GetDataset(basepath)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
-	err = dataset.Destroy("")
+	err = dataset.DestroyWithFlags(zfs.DestroyFlags{})
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
@@ -291,13 +423,13 @@ func HandlerForceDestroyProject(w http.ResponseWriter, r *http.Request) {
 
 	dataset, err := zfs.GetDataset(basepath)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
-	err = dataset.Destroy("-R")
+	err = dataset.DestroyWithFlags(zfs.DestroyFlags{Dependents: true})
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
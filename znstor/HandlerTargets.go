@@ -5,8 +5,8 @@ import (
 	"github.com/d-helios/znstord/itadm"
 	"github.com/d-helios/znstord/stmf"
 	"github.com/gorilla/mux"
-	"io"
 	"net/http"
+	"strings"
 )
 
 /*
@@ -17,7 +17,7 @@ Target Groups
 func HandlerGetTargetGroupList(w http.ResponseWriter, r *http.Request) {
 	targetGroups, err := stmf.ListTargetGroups()
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
@@ -27,7 +27,7 @@ func HandlerGetTargetGroupList(w http.ResponseWriter, r *http.Request) {
 		err = json.NewEncoder(w).Encode(targetGroups)
 	}
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 	}
 }
 
@@ -37,13 +37,13 @@ func HandlerGetTargetGroup(w http.ResponseWriter, r *http.Request) {
 
 	targetGroup, err := stmf.GetTargetGroup(targetgroupName)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	err = json.NewEncoder(w).Encode(targetGroup)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 	}
 }
 
@@ -52,21 +52,26 @@ func HandlerAddTargetGroupMember(w http.ResponseWriter, r *http.Request) {
 	targetgroupName := vars["targetgroup"]
 	memberName := vars["member"]
 
+	unlock := locks.Lock(targetGroupLockKey(targetgroupName))
+	defer unlock()
+
 	targetgroup, err := stmf.GetTargetGroup(targetgroupName)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
+	unlockComstar := locks.LockComstar()
 	err = targetgroup.AddMember(memberName)
+	unlockComstar()
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	err = json.NewEncoder(w).Encode(targetgroup)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 	}
 }
 
@@ -75,20 +80,26 @@ func HandlerRemoveTargetGroupMember(w http.ResponseWriter, r *http.Request) {
 	targetgroupName := vars["targetgroup"]
 	memberName := vars["member"]
 
+	unlock := locks.Lock(targetGroupLockKey(targetgroupName))
+	defer unlock()
+
 	targetgroup, err := stmf.GetTargetGroup(targetgroupName)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
+
+	unlockComstar := locks.LockComstar()
 	err = targetgroup.RemoveMember(memberName)
+	unlockComstar()
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	err = json.NewEncoder(w).Encode(targetgroup)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 	}
 }
 
@@ -96,11 +107,16 @@ func HandlerDeleteTargetGroup(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	targetgroupName := vars["targetgroup"]
 
+	unlock := locks.Lock(targetGroupLockKey(targetgroupName))
+	defer unlock()
+
 	targetgroup, err := stmf.GetTargetGroup(targetgroupName)
 
+	unlockComstar := locks.LockComstar()
 	err = targetgroup.Delete()
+	unlockComstar()
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 	}
 }
 
@@ -108,15 +124,20 @@ func HandlerCreateTargetGroup(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	targetgroupName := vars["targetgroup"]
 
+	unlock := locks.Lock(targetGroupLockKey(targetgroupName))
+	defer unlock()
+
+	unlockComstar := locks.LockComstar()
 	targetgroup, err := stmf.CreateTargetGroup(targetgroupName)
+	unlockComstar()
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	err = json.NewEncoder(w).Encode(targetgroup)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 	}
 }
 
@@ -128,32 +149,31 @@ TargetPortGroups
 func HandlerCreateTargetPortGroup(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	// tpg == target port group
-	tpgName := vars["tpg"]
+	tpgName := vars["target_port_group"]
 
 	var tpgOptions TpgCreateRequest
-	decoder := json.NewDecoder(io.LimitReader(r.Body, requestPayloadMaxSize))
-	err := decoder.Decode(&tpgOptions)
+	err := decodeRequest(r, &tpgOptions, requestPayloadMaxSize)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
-	tpg, err := itadm.CreateTargetPortGroup(tpgName, tpgOptions.portals)
+	tpg, err := itadm.CreateTargetPortGroup(tpgName, tpgOptions.Portals)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	err = json.NewEncoder(w).Encode(tpg)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 	}
 }
 
 func HandlerGetTargetPortGroupList(w http.ResponseWriter, r *http.Request) {
 	tpg, err := itadm.ListTargetPortGroups("")
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
@@ -166,52 +186,52 @@ func HandlerGetTargetPortGroupList(w http.ResponseWriter, r *http.Request) {
 
 	// check json.NewEncoder error
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 	}
 }
 
 func HandlerGetTargetPortGroup(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	tpgName := vars["tpg"]
+	tpgName := vars["target_port_group"]
 	tpg, err := itadm.GetTargetPortGroup(tpgName)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	err = json.NewEncoder(w).Encode(tpg)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 	}
 }
 
 func HandlerDeleteTargetPortGroup(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	tpgName := vars["tpg"]
+	tpgName := vars["target_port_group"]
 	tpg, err := itadm.GetTargetPortGroup(tpgName)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	err = tpg.Delete(false)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 	}
 }
 
 func HandlerForceDeleteTargetPortGroup(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	tpgName := vars["tpg"]
+	tpgName := vars["target_port_group"]
 	tpg, err := itadm.GetTargetPortGroup(tpgName)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	err = tpg.Delete(true)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 	}
 }
 
@@ -222,10 +242,9 @@ Targets
 */
 func HandlerCreateTarget(w http.ResponseWriter, r *http.Request) {
 	var targetOptions TargetCreateRequest
-	decoder := json.NewDecoder(io.LimitReader(r.Body, requestPayloadMaxSize))
-	err := decoder.Decode(&targetOptions)
+	err := decodeRequest(r, &targetOptions, requestPayloadMaxSize)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
@@ -236,32 +255,62 @@ func HandlerCreateTarget(w http.ResponseWriter, r *http.Request) {
 	)
 
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	err = json.NewEncoder(w).Encode(target)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 	}
 }
 
 func HandlerGetTargetList(w http.ResponseWriter, r *http.Request) {
+	params, err := parseListParams(r, listSortName)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	// filters
+	namePrefix := params.Query.Get("name_prefix")
+	aliasPrefix := params.Query.Get("alias_prefix")
+	state := params.Query.Get("state")
+
 	targets, err := itadm.ListTargets("")
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
-	if targets == nil {
-		// return empty array
-		err = json.NewEncoder(w).Encode([]string{})
-	} else {
-		err = json.NewEncoder(w).Encode(targets)
+	var items []listItem
+	for _, target := range targets {
+		if !strings.HasPrefix(target.IQN, namePrefix) ||
+			!strings.HasPrefix(target.Alias, aliasPrefix) {
+			continue
+		}
+		if state != "" && !strings.EqualFold(target.State, state) {
+			continue
+		}
+
+		items = append(items, listItem{
+			Key:   target.IQN,
+			Name:  target.IQN,
+			Value: target,
+		})
 	}
 
+	// return empty array if there is no targets
+	page, err := paginate(w, items, params)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(page)
+
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 	}
 }
 
@@ -271,13 +320,13 @@ func HandlerGetTarget(w http.ResponseWriter, r *http.Request) {
 
 	target, err := itadm.GetTarget(targetName)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	err = json.NewEncoder(w).Encode(target)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 	}
 }
 
@@ -287,13 +336,13 @@ func HandlerDeleteTarget(w http.ResponseWriter, r *http.Request) {
 
 	target, err := itadm.GetTarget(targetName)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	err = target.Delete(false)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 	}
 }
 
@@ -303,12 +352,12 @@ func HandlerForceDeleteTarget(w http.ResponseWriter, r *http.Request) {
 
 	target, err := itadm.GetTarget(targetName)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	err = target.Delete(true)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 	}
 }
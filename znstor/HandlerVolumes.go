@@ -2,64 +2,155 @@ package znstor
 
 import (
 	"encoding/json"
-	"github.com/d-helios/znstord/stmf"
 	"github.com/d-helios/znstord/zfs"
 	"github.com/gorilla/mux"
-	"github.com/twinj/uuid"
-	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 )
 
 // HandlerGetVolumeList - get volume list
 
-func HandlerGetVolumeJobStatus(w http.ResponseWriter, r *http.Request) {
+func HandlerGetJobStatus(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	statusUuid := vars["uuid"]
 
-	status, err := ioutil.ReadFile(asyncResultDir + statusUuid + ".status")
+	status, err := ioutil.ReadFile(jobStatusFile(statusUuid))
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	// failed job status: error code and message
+	if lines := strings.SplitN(string(status), "\n", 2); len(lines) == 2 {
+		sendCodedMessage(w, http.StatusOK, traceFunctionName(), lines[0], lines[1])
 		return
 	}
 
 	sendMessage(w, http.StatusOK, traceFunctionName(), string(status))
 }
 
-func HandlerGetVolumeList(w http.ResponseWriter, r *http.Request) {
+// Run batch of volume operations as async job.
+// Per operation results are available as job result
+func HandlerVolumeBatch(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	domainName := vars["domain"]
 	poolName := vars["pool"]
 	projectName := vars["project"]
 	basepath := poolName + "/" + domainName + "/" + projectName
 
-	// lock mutex to perform atomic view
-	vol_mutex.Lock()
+	var reqJson BatchRequest
+	err := decodeRequest(r, &reqJson, batchPayloadMaxSize)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	requestUuid := startJobWithResult(func() (interface{}, error) {
+		result, err := RunBatch(basepath, reqJson)
+		// batch was refused before any operation, there is no result
+		if result == nil {
+			return nil, err
+		}
+		return result, err
+	})
+
+	log.Printf("===\n%s: %s\n\n", traceFunctionName(), json.NewEncoder(os.Stdout).Encode(requestUuid))
+	sendMessage(w, http.StatusAccepted, traceFunctionName(), requestUuid)
+}
+
+// Get result of the job, which reports per item results (ex: batch)
+func HandlerGetJobResult(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	statusUuid := vars["uuid"]
 
-	lus, err := stmf.ListLUs("")
+	result, err := ioutil.ReadFile(jobResultFile(statusUuid))
 	if err != nil {
-		vol_mutex.Unlock()
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendCodedMessage(w, http.StatusNotFound, traceFunctionName(), codeNotFound, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(result)
+}
+
+func HandlerGetVolumeList(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	domainName := vars["domain"]
+	poolName := vars["pool"]
+	projectName := vars["project"]
+	basepath := poolName + "/" + domainName + "/" + projectName
+
+	params, err := parseListParams(r, listSortName, listSortSize, listSortCreation)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
 		return
 	}
-	// unlock mutex
-	vol_mutex.Unlock()
 
 	// only lu's associeted with project
-	var projectLus = make([]stmf.LogicalUnit, 0)
+	projectVolumes, err := inv.ProjectVolumes(basepath, isFresh(r))
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	// filters
+	aliasPrefix := params.Query.Get("alias_prefix")
+	status := params.Query.Get("status")
+	state := params.Query.Get("state")
+
+	tags, err := parseTagFilters(params)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	var tagged map[string]bool
+	if len(tags) > 0 {
+		tagged, err = taggedDatasets(zfs.Volume, basepath, 0, tags)
+		if err != nil {
+			sendError(w, traceFunctionName(), err)
+			return
+		}
+	}
 
-	for _, lu := range lus {
-		if IsVolumeBelongsToProject(basepath, *lu) {
-			projectLus = append(projectLus, *lu)
+	var items []listItem
+	for _, volume := range projectVolumes {
+		if !strings.HasPrefix(volume.Alias, aliasPrefix) {
+			continue
+		}
+		if tagged != nil && !tagged[volume.GetZvol()] {
+			continue
+		}
+		if status != "" && !strings.EqualFold(volume.OperationalStatus, status) {
+			continue
 		}
+		if state != "" && volume.State != state {
+			continue
+		}
+
+		items = append(items, listItem{
+			Key:      volume.LUName,
+			Name:     volume.Alias,
+			Size:     volume.Size,
+			Creation: parseUintProp(inv.ZvolProp(volume.GetZvol(), "creation")),
+			Value:    volume,
+		})
+	}
+
+	page, err := paginate(w, items, params)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
 	}
 
-	err = json.NewEncoder(w).Encode(projectLus)
+	err = json.NewEncoder(w).Encode(page)
 
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 }
@@ -73,22 +164,30 @@ func HandlerGetVolume(w http.ResponseWriter, r *http.Request) {
 	basepath := poolName + "/" + domainName + "/" + projectName
 	volumeName := vars["volume"]
 
-	lu, err := stmf.GetLu(volumeName)
+	lu, err := inv.GetLu(volumeName, isFresh(r))
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	if IsVolumeBelongsToProject(basepath, *lu) {
-		err := json.NewEncoder(w).Encode(lu)
+		volume := inv.Volume(lu)
+
+		volume.Properties, err = datasetProperties(lu.GetZvol())
+		if err != nil {
+			sendError(w, traceFunctionName(), err)
+			return
+		}
+
+		err = json.NewEncoder(w).Encode(volume)
 		if err != nil {
-			sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+			sendError(w, traceFunctionName(), err)
 			return
 		}
 		return
 	}
 
-	sendMessage(w, http.StatusBadRequest, traceFunctionName(),
+	sendCodedMessage(w, http.StatusNotFound, traceFunctionName(), codeNotFound,
 		"Volume not found in specified project")
 	return
 }
@@ -101,10 +200,9 @@ func HandlerCreateVolume(w http.ResponseWriter, r *http.Request) {
 	projectName := vars["project"]
 
 	var reqJson ZVolCreateRequest
-	decoder := json.NewDecoder(io.LimitReader(r.Body, requestPayloadMaxSize))
-	err := decoder.Decode(&reqJson)
+	err := decodeRequest(r, &reqJson, requestPayloadMaxSize)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
@@ -112,14 +210,14 @@ func HandlerCreateVolume(w http.ResponseWriter, r *http.Request) {
 
 	lu, err := CreateVolume(basepath, reqJson)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	log.Printf("===\n%s: %s\n\n", traceFunctionName(), json.NewEncoder(os.Stdout).Encode(lu))
 	err = json.NewEncoder(w).Encode(lu)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 }
@@ -133,40 +231,22 @@ func HandlerDestroyVolume(w http.ResponseWriter, r *http.Request) {
 	volumeName := vars["volume"]
 	basepath := poolName + "/" + domainName + "/" + projectName
 
-	lu, err := stmf.GetLu(volumeName)
+	lu, err := inv.GetLu(volumeName, isFresh(r))
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	if !IsVolumeBelongsToProject(basepath, *lu) {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(),
+		sendCodedMessage(w, http.StatusNotFound, traceFunctionName(), codeNotFound,
 			"Volume not found in specified project")
 		return
 	}
 
-	requestUuid := uuid.NewV4().String()
-
-	go func() {
-		// status uuid
-		// request status file
-		statusFile := asyncResultDir + requestUuid + ".status"
-
-		// start logging
-		ioutil.WriteFile(statusFile, []byte(asyncOptStatusInProgress), 0644)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		// destroy volume
-		if err := VolDestroy(lu.LUName); err != nil {
-			// log operation failed
-			ioutil.WriteFile(statusFile, []byte(err.Error()), 0644)
-		} else {
-			// log operation successfully
-			ioutil.WriteFile(statusFile, []byte(asyncOptStatusCompletedSuccefully), 0644)
-		}
-	}()
+	// destroy volume
+	requestUuid := startJob(func() error {
+		return VolDestroy(lu.LUName)
+	})
 
 	log.Printf("===\n%s: %s\n\n", traceFunctionName(), json.NewEncoder(os.Stdout).Encode(requestUuid))
 	sendMessage(w, http.StatusAccepted, traceFunctionName(), requestUuid)
@@ -182,27 +262,27 @@ func HandlerCreateVolumeSnapshot(w http.ResponseWriter, r *http.Request) {
 	snapshotName := vars["snapshot"]
 	basepath := poolName + "/" + domainName + "/" + projectName
 
-	lu, err := stmf.GetLu(volumeName)
+	lu, err := inv.GetLu(volumeName, isFresh(r))
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	if !IsVolumeBelongsToProject(basepath, *lu) {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), "Volume not found in specified project")
+		sendCodedMessage(w, http.StatusNotFound, traceFunctionName(), codeNotFound, "Volume not found in specified project")
 		return
 	}
 
 	snapshot, err := VolSnapshot(lu.LUName, snapshotName)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	log.Printf("===\n%s: %s\n\n", traceFunctionName(), json.NewEncoder(os.Stdout).Encode(snapshot))
 	err = json.NewEncoder(w).Encode(snapshot)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 }
@@ -216,34 +296,81 @@ func HandlerGetVolumeSnapshotList(w http.ResponseWriter, r *http.Request) {
 	volumeName := vars["volume"]
 	basepath := poolName + "/" + domainName + "/" + projectName
 
-	lu, err := stmf.GetLu(volumeName)
+	lu, err := inv.GetLu(volumeName, isFresh(r))
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	if !IsVolumeBelongsToProject(basepath, *lu) {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), "Volume not found in specified project")
+		sendCodedMessage(w, http.StatusNotFound, traceFunctionName(), codeNotFound, "Volume not found in specified project")
+		return
+	}
+
+	params, err := parseListParams(r, listSortName, listSortSize, listSortCreation)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	// filters
+	namePrefix := params.Query.Get("name_prefix")
+	olderThan, filterAge, err := parseUintFilter(params, "older_than")
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
-	snapshots, err := zfs.ListDatasets(zfs.Snapshot, lu.GetZvol(), true, 1)
+	tags, err := parseTagFilters(params)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
-	if snapshots == nil {
-		// return empty array
-		log.Printf("===\n%s: %s\n\n", traceFunctionName(), json.NewEncoder(os.Stdout).Encode([]string{}))
-		err = json.NewEncoder(w).Encode([]string{})
-	} else {
-		log.Printf("===\n%s: %s\n\n", traceFunctionName(), json.NewEncoder(os.Stdout).Encode(lu))
-		err = json.NewEncoder(w).Encode(snapshots)
+	snapshots, err := zfs.ListDatasetProps(zfs.Snapshot, lu.GetZvol(), true, 1, append([]string{"used", "creation"}, tagNames(tags)...)...)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	now := uint64(time.Now().Unix())
+
+	var items []listItem
+	for _, snapshot := range snapshots {
+		name := snapshot["name"][strings.Index(snapshot["name"], "@")+1:]
+		creation := parseUintProp(snapshot["creation"])
+		used := parseUintProp(snapshot["used"])
+
+		if !strings.HasPrefix(name, namePrefix) {
+			continue
+		}
+		if filterAge && creation+olderThan > now {
+			continue
+		}
+		if !matchTags(snapshot, tags) {
+			continue
+		}
+
+		items = append(items, listItem{
+			Key:      name,
+			Name:     name,
+			Size:     used,
+			Creation: creation,
+			Value:    &zfs.Dataset{Dataset: snapshot["name"]},
+		})
+	}
+
+	page, err := paginate(w, items, params)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
 	}
 
+	log.Printf("===\n%s: %s\n\n", traceFunctionName(), json.NewEncoder(os.Stdout).Encode(page))
+	err = json.NewEncoder(w).Encode(page)
+
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 }
@@ -258,27 +385,33 @@ func HandlerGetVolumeSnapshot(w http.ResponseWriter, r *http.Request) {
 	snapshotName := vars["snapshot"]
 	basepath := poolName + "/" + domainName + "/" + projectName
 
-	lu, err := stmf.GetLu(volumeName)
+	lu, err := inv.GetLu(volumeName, isFresh(r))
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	if !IsVolumeBelongsToProject(basepath, *lu) {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), "Volume not found in specified project")
+		sendCodedMessage(w, http.StatusNotFound, traceFunctionName(), codeNotFound, "Volume not found in specified project")
 		return
 	}
 
 	snapshot, err := zfs.GetDataset(lu.GetZvol() + "@" + snapshotName)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
+	if err := snapshot.RefreshProps(); err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+	snapshot.Properties = publicProperties(snapshot.Properties)
+
 	log.Printf("===\n%s: %s\n\n", traceFunctionName(), json.NewEncoder(os.Stdout).Encode(snapshot))
 	err = json.NewEncoder(w).Encode(snapshot)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 }
@@ -293,45 +426,27 @@ func HandlerDestroyVolumeSnapshot(w http.ResponseWriter, r *http.Request) {
 	snapshotName := vars["snapshot"]
 	basepath := poolName + "/" + domainName + "/" + projectName
 
-	lu, err := stmf.GetLu(volumeName)
+	lu, err := inv.GetLu(volumeName, isFresh(r))
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	if !IsVolumeBelongsToProject(basepath, *lu) {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), "Volume not found in specified project")
+		sendCodedMessage(w, http.StatusNotFound, traceFunctionName(), codeNotFound, "Volume not found in specified project")
 		return
 	}
 
 	snapshot, err := zfs.GetDataset(lu.GetZvol() + "@" + snapshotName)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
-	requestUuid := uuid.NewV4().String()
-
-	go func() {
-		// status uuid
-		// request status file
-		statusFile := asyncResultDir + requestUuid + ".status"
-
-		// start logging
-		ioutil.WriteFile(statusFile, []byte(asyncOptStatusInProgress), 0644)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		// destroy snapshot
-		if err := snapshot.Destroy(""); err != nil {
-			// log operation failed
-			ioutil.WriteFile(statusFile, []byte(err.Error()), 0644)
-		} else {
-			// log operation successfully
-			ioutil.WriteFile(statusFile, []byte(asyncOptStatusCompletedSuccefully), 0644)
-		}
-	}()
+	// destroy snapshot
+	requestUuid := startJob(func() error {
+		return snapshot.DestroyWithFlags(zfs.DestroyFlags{})
+	})
 	sendMessage(w, http.StatusAccepted, traceFunctionName(), requestUuid)
 }
 
@@ -345,27 +460,27 @@ func HandlerRollbackVolumeSnapshot(w http.ResponseWriter, r *http.Request) {
 	snapshotName := vars["snapshot"]
 	basepath := poolName + "/" + domainName + "/" + projectName
 
-	lu, err := stmf.GetLu(volumeName)
+	lu, err := inv.GetLu(volumeName, isFresh(r))
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	if !IsVolumeBelongsToProject(basepath, *lu) {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), "Volume not found in specified project")
+		sendCodedMessage(w, http.StatusNotFound, traceFunctionName(), codeNotFound, "Volume not found in specified project")
 		return
 	}
 
-	err = VolRollback(lu.LUName, snapshotName)
+	volume, err := VolRollback(lu.LUName, snapshotName, isQuiesce(r))
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
-	log.Printf("===\n%s: %s\n\n", traceFunctionName(), json.NewEncoder(os.Stdout).Encode(lu))
-	err = json.NewEncoder(w).Encode(lu)
+	log.Printf("===\n%s: %s\n\n", traceFunctionName(), json.NewEncoder(os.Stdout).Encode(volume))
+	err = json.NewEncoder(w).Encode(volume)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 }
@@ -381,45 +496,58 @@ func HandlerCloneVolumeFromSnapshot(w http.ResponseWriter, r *http.Request) {
 	basepath := poolName + "/" + domainName + "/" + projectName
 
 	var reqJson ZVolCloneRequest
-	decoder := json.NewDecoder(io.LimitReader(r.Body, requestPayloadMaxSize))
-	err := decoder.Decode(&reqJson)
+	err := decodeRequest(r, &reqJson, requestPayloadMaxSize)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	if reqJson.Alias == "" {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), "Alias not specified")
+		sendCodedMessage(w, http.StatusUnprocessableEntity, traceFunctionName(), codeInvalidArgument, "Alias not specified")
 		return
 	}
 
-	lu, err := stmf.GetLu(volumeName)
+	lu, err := inv.GetLu(volumeName, isFresh(r))
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	if !IsVolumeBelongsToProject(basepath, *lu) {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), "Volume not found in specified project")
+		sendCodedMessage(w, http.StatusNotFound, traceFunctionName(), codeNotFound, "Volume not found in specified project")
 		return
 	}
 
-	clone, err := VolCloneFromSnapshot(lu.LUName, snapshotName, reqJson.Alias)
+	clone, err := VolCloneFromSnapshot(lu.LUName, snapshotName, reqJson.Alias, reqJson.Exports)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	log.Printf("===\n%s: %s\n\n", traceFunctionName(), json.NewEncoder(os.Stdout).Encode(clone))
 	err = json.NewEncoder(w).Encode(clone)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 }
 
 // VolResize Volume
 func HandlerResizeVolume(w http.ResponseWriter, r *http.Request) {
+	resizeVolume(w, r, resizeAny)
+}
+
+// Grow Volume
+func HandlerGrowVolume(w http.ResponseWriter, r *http.Request) {
+	resizeVolume(w, r, resizeGrow)
+}
+
+// Shrink Volume
+func HandlerShrinkVolume(w http.ResponseWriter, r *http.Request) {
+	resizeVolume(w, r, resizeShrink)
+}
+
+func resizeVolume(w http.ResponseWriter, r *http.Request, direction int) {
 	vars := mux.Vars(r)
 	domainName := vars["domain"]
 	poolName := vars["pool"]
@@ -428,34 +556,33 @@ func HandlerResizeVolume(w http.ResponseWriter, r *http.Request) {
 	basepath := poolName + "/" + domainName + "/" + projectName
 
 	var reqJson ZvolResizeRequest
-	decoder := json.NewDecoder(io.LimitReader(r.Body, requestPayloadMaxSize))
-	err := decoder.Decode(&reqJson)
+	err := decodeRequest(r, &reqJson, requestPayloadMaxSize)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
-	volume, err := stmf.GetLu(volumeName)
+	volume, err := inv.GetLu(volumeName, isFresh(r))
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	if !IsVolumeBelongsToProject(basepath, *volume) {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), "Volume not found in specified project")
+		sendCodedMessage(w, http.StatusNotFound, traceFunctionName(), codeNotFound, "Volume not found in specified project")
 		return
 	}
 
-	err = VolResize(volume.LUName, reqJson.VolSize)
+	resized, err := VolResize(volume.LUName, reqJson, direction, isQuiesce(r))
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
-	log.Printf("===\n%s: %s\n\n", traceFunctionName(), json.NewEncoder(os.Stdout).Encode(volume))
-	err = json.NewEncoder(w).Encode(volume)
+	log.Printf("===\n%s: %s\n\n", traceFunctionName(), json.NewEncoder(os.Stdout).Encode(resized))
+	err = json.NewEncoder(w).Encode(resized)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 }
@@ -471,21 +598,21 @@ func HandlerSetVolumeCompression(w http.ResponseWriter, r *http.Request) {
 
 	basepath := poolName + "/" + domainName + "/" + projectName
 
-	lu, err := stmf.GetLu(volumeName)
+	lu, err := inv.GetLu(volumeName, isFresh(r))
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	if !IsVolumeBelongsToProject(basepath, *lu) {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), "Volume not found in specified project")
+		sendCodedMessage(w, http.StatusNotFound, traceFunctionName(), codeNotFound, "Volume not found in specified project")
 		return
 	}
 
 	zvol, err := zfs.GetDataset(lu.GetZvol())
 	err = zvol.SetProp("compression", compressionType)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
@@ -493,7 +620,7 @@ func HandlerSetVolumeCompression(w http.ResponseWriter, r *http.Request) {
 	log.Printf("===\n%s: %s\n\n", traceFunctionName(), json.NewEncoder(os.Stdout).Encode(zvol))
 	err = json.NewEncoder(w).Encode(lu)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 }
@@ -507,36 +634,39 @@ func HandlerExportVolume(w http.ResponseWriter, r *http.Request) {
 	volumeName := vars["volume"]
 
 	var reqJson ExportRequest
-	decoder := json.NewDecoder(r.Body)
-	err := decoder.Decode(&reqJson)
+	err := decodeRequest(r, &reqJson, requestPayloadMaxSize)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	basepath := poolName + "/" + domainName + "/" + projectName
 
-	lu, err := stmf.GetLu(volumeName)
+	lu, err := inv.GetLu(volumeName, isFresh(r))
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	if !IsVolumeBelongsToProject(basepath, *lu) {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), "Volume not found in specified project")
+		sendCodedMessage(w, http.StatusNotFound, traceFunctionName(), codeNotFound, "Volume not found in specified project")
 		return
 	}
 
-	view, err := lu.AddView(reqJson.Hostgroup, reqJson.Targetgroup, reqJson.Lun)
+	unlock := locks.Lock(luLockKey(lu.LUName),
+		hostGroupLockKey(reqJson.Hostgroup), targetGroupLockKey(reqJson.Targetgroup))
+	defer unlock()
+
+	view, err := addView(lu, reqJson)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), "Volume not found in specified project")
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	log.Printf("===\n%s: %s\n\n", traceFunctionName(), json.NewEncoder(os.Stdout).Encode(view))
 	err = json.NewEncoder(w).Encode(view)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 	}
 }
 
@@ -549,44 +679,46 @@ func HandlerUnExportVolume(w http.ResponseWriter, r *http.Request) {
 	volumeName := vars["volume"]
 
 	var reqJson ExportRequest
-	decoder := json.NewDecoder(io.LimitReader(r.Body, requestPayloadMaxSize))
-	err := decoder.Decode(&reqJson)
+	err := decodeRequest(r, &reqJson, requestPayloadMaxSize)
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	basepath := poolName + "/" + domainName + "/" + projectName
 
-	lu, err := stmf.GetLu(volumeName)
+	lu, err := inv.GetLu(volumeName, isFresh(r))
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	if !IsVolumeBelongsToProject(basepath, *lu) {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), "Volume not found in specified project")
+		sendCodedMessage(w, http.StatusNotFound, traceFunctionName(), codeNotFound, "Volume not found in specified project")
 		return
 	}
 
-	if lu.ViewEntryCount > 0 {
-		viewNumber, err := lu.GetViewEntry(reqJson.Hostgroup, reqJson.Targetgroup)
-		if err != nil {
-			sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
-			return
-		}
-		if err = lu.RemoveView(viewNumber.ViewEntry); err != nil {
-			sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
-			return
-		}
+	unlock := locks.Lock(luLockKey(lu.LUName),
+		hostGroupLockKey(reqJson.Hostgroup), targetGroupLockKey(reqJson.Targetgroup))
+	defer unlock()
 
-		json.NewEncoder(w).Encode(lu)
+	// view entry count of the cached LU could be stale, so ask COMSTAR
+	viewNumber, err := lu.GetViewEntry(reqJson.Hostgroup, reqJson.Targetgroup)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
 		return
+	}
 
-	} else {
-		sendMessage(w, http.StatusNotFound, traceFunctionName(), err.Error())
+	unlockComstar := locks.LockComstar()
+	err = lu.RemoveView(viewNumber.ViewEntry)
+	unlockComstar()
+	inv.UpdateLu(lu)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
 		return
 	}
+
+	json.NewEncoder(w).Encode(lu)
 }
 
 func HandlerGetVolumeExports(w http.ResponseWriter, r *http.Request) {
@@ -598,14 +730,14 @@ func HandlerGetVolumeExports(w http.ResponseWriter, r *http.Request) {
 
 	basepath := poolName + "/" + domainName + "/" + projectName
 
-	lu, err := stmf.GetLu(volumeName)
+	lu, err := inv.GetLu(volumeName, isFresh(r))
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 
 	if !IsVolumeBelongsToProject(basepath, *lu) {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), "Volume not found in specified project")
+		sendCodedMessage(w, http.StatusNotFound, traceFunctionName(), codeNotFound, "Volume not found in specified project")
 		return
 	}
 
@@ -614,10 +746,301 @@ func HandlerGetVolumeExports(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	views, err := lu.ListView()
+	views, err := inv.Views(lu, isFresh(r))
 	if err != nil {
-		sendMessage(w, http.StatusBadRequest, traceFunctionName(), err.Error())
+		sendError(w, traceFunctionName(), err)
 		return
 	}
 	json.NewEncoder(w).Encode(views)
 }
+
+// Rename Volume
+func HandlerRenameVolume(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	domainName := vars["domain"]
+	poolName := vars["pool"]
+	projectName := vars["project"]
+	volumeName := vars["volume"]
+	basepath := poolName + "/" + domainName + "/" + projectName
+
+	var reqJson ZVolRenameRequest
+	err := decodeRequest(r, &reqJson, requestPayloadMaxSize)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	if reqJson.Alias == "" {
+		sendCodedMessage(w, http.StatusUnprocessableEntity, traceFunctionName(), codeInvalidArgument, "Alias not specified")
+		return
+	}
+
+	lu, err := inv.GetLu(volumeName, isFresh(r))
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	if !IsVolumeBelongsToProject(basepath, *lu) {
+		sendCodedMessage(w, http.StatusNotFound, traceFunctionName(), codeNotFound, "Volume not found in specified project")
+		return
+	}
+
+	renamed, err := VolRename(lu.LUName, reqJson.Alias, reqJson.Force)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	log.Printf("===\n%s: %s\n\n", traceFunctionName(), json.NewEncoder(os.Stdout).Encode(renamed))
+	err = json.NewEncoder(w).Encode(renamed)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+}
+
+// Move Volume to another project or pool
+func HandlerMoveVolume(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	domainName := vars["domain"]
+	poolName := vars["pool"]
+	projectName := vars["project"]
+	volumeName := vars["volume"]
+	basepath := poolName + "/" + domainName + "/" + projectName
+
+	var reqJson ZVolMoveRequest
+	err := decodeRequest(r, &reqJson, requestPayloadMaxSize)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	if reqJson.Project == "" {
+		sendCodedMessage(w, http.StatusUnprocessableEntity, traceFunctionName(), codeInvalidArgument, "Project not specified")
+		return
+	}
+
+	if reqJson.Pool == "" {
+		reqJson.Pool = poolName
+	}
+
+	if isPrivatePool(reqJson.Pool) {
+		sendCodedMessage(w, http.StatusForbidden, traceFunctionName(), codePermissionDenied, "PERMISSION DENIED on POOL: "+reqJson.Pool)
+		return
+	}
+
+	targetBasepath := reqJson.Pool + "/" + domainName + "/" + reqJson.Project
+
+	if _, err := zfs.GetDataset(targetBasepath); err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	lu, err := inv.GetLu(volumeName, isFresh(r))
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	if !IsVolumeBelongsToProject(basepath, *lu) {
+		sendCodedMessage(w, http.StatusNotFound, traceFunctionName(), codeNotFound, "Volume not found in specified project")
+		return
+	}
+
+	if !reqJson.Force {
+		if err := checkNoSessions(lu); err != nil {
+			sendError(w, traceFunctionName(), err)
+			return
+		}
+	}
+
+	// move volume
+	requestUuid := startJob(func() error {
+		_, err := VolMove(lu.LUName, targetBasepath, reqJson.Force)
+		return err
+	})
+
+	log.Printf("===\n%s: %s\n\n", traceFunctionName(), json.NewEncoder(os.Stdout).Encode(requestUuid))
+	sendMessage(w, http.StatusAccepted, traceFunctionName(), requestUuid)
+}
+
+// List zvols not managed by znstor within domain
+func HandlerGetUnmanagedVolumes(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	domainName := vars["domain"]
+	poolName := vars["pool"]
+
+	volumes, err := ListUnmanagedVolumes(poolName + "/" + domainName)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(volumes)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+	}
+}
+
+// List logical units based on zvols not managed by znstor within domain
+func HandlerGetUnmanagedLUs(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	domainName := vars["domain"]
+	poolName := vars["pool"]
+
+	lus, err := ListUnmanagedLUs(poolName + "/" + domainName)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(lus)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+	}
+}
+
+// Adopt unmanaged zvol into project
+func HandlerAdoptVolume(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	domainName := vars["domain"]
+	poolName := vars["pool"]
+	projectName := vars["project"]
+	basepath := poolName + "/" + domainName + "/" + projectName
+
+	var reqJson ZVolAdoptRequest
+	err := decodeRequest(r, &reqJson, requestPayloadMaxSize)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	// only zvols within domain can be adopted
+	if !strings.HasPrefix(reqJson.Zvol, poolName+"/"+domainName+"/") {
+		sendCodedMessage(w, http.StatusNotFound, traceFunctionName(), codeNotFound, "Zvol not found in specified domain")
+		return
+	}
+
+	lu, err := VolAdopt(basepath, reqJson.Zvol, reqJson.Force)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	log.Printf("===\n%s: %s\n\n", traceFunctionName(), json.NewEncoder(os.Stdout).Encode(lu))
+	err = json.NewEncoder(w).Encode(lu)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+	}
+}
+
+// Release volume from management. Zvol and logical unit are kept
+func HandlerReleaseVolume(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	domainName := vars["domain"]
+	poolName := vars["pool"]
+	projectName := vars["project"]
+	volumeName := vars["volume"]
+	basepath := poolName + "/" + domainName + "/" + projectName
+
+	lu, err := inv.GetLu(volumeName, isFresh(r))
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	if !IsVolumeBelongsToProject(basepath, *lu) {
+		sendCodedMessage(w, http.StatusNotFound, traceFunctionName(), codeNotFound, "Volume not found in specified project")
+		return
+	}
+
+	if err := VolRelease(lu.LUName); err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	sendMessage(w, http.StatusOK, traceFunctionName(), "")
+}
+
+// Modify Volume logical unit and zvol properties
+func HandlerModifyVolume(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	domainName := vars["domain"]
+	poolName := vars["pool"]
+	projectName := vars["project"]
+	volumeName := vars["volume"]
+	basepath := poolName + "/" + domainName + "/" + projectName
+
+	var reqJson ZVolPatchRequest
+	err := decodeRequest(r, &reqJson, requestPayloadMaxSize)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	lu, err := inv.GetLu(volumeName, isFresh(r))
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	if !IsVolumeBelongsToProject(basepath, *lu) {
+		sendCodedMessage(w, http.StatusNotFound, traceFunctionName(), codeNotFound, "Volume not found in specified project")
+		return
+	}
+
+	volume, err := VolModify(lu.LUName, reqJson)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	log.Printf("===\n%s: %s\n\n", traceFunctionName(), json.NewEncoder(os.Stdout).Encode(volume))
+	err = json.NewEncoder(w).Encode(volume)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+	}
+}
+
+// Take Volume logical unit offline
+func HandlerOfflineVolume(w http.ResponseWriter, r *http.Request) {
+	setVolumeOnline(w, r, false)
+}
+
+// Bring Volume logical unit online
+func HandlerOnlineVolume(w http.ResponseWriter, r *http.Request) {
+	setVolumeOnline(w, r, true)
+}
+
+func setVolumeOnline(w http.ResponseWriter, r *http.Request, online bool) {
+	vars := mux.Vars(r)
+	domainName := vars["domain"]
+	poolName := vars["pool"]
+	projectName := vars["project"]
+	volumeName := vars["volume"]
+	basepath := poolName + "/" + domainName + "/" + projectName
+
+	lu, err := inv.GetLu(volumeName, isFresh(r))
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	if !IsVolumeBelongsToProject(basepath, *lu) {
+		sendCodedMessage(w, http.StatusNotFound, traceFunctionName(), codeNotFound, "Volume not found in specified project")
+		return
+	}
+
+	volume, err := VolSetOnline(lu.LUName, online)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	log.Printf("===\n%s: %s\n\n", traceFunctionName(), json.NewEncoder(os.Stdout).Encode(volume))
+	err = json.NewEncoder(w).Encode(volume)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+	}
+}
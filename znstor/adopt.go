@@ -0,0 +1,391 @@
+package znstor
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/d-helios/znstord/stmf"
+	"github.com/d-helios/znstord/zfs"
+)
+
+// isManagedFlag - zvol with such service flag is managed by znstor
+func isManagedFlag(sflag string) bool {
+	return sflag == sflagManaged || sflag == sflagDeleting
+}
+
+// zvolFlag - current service flag of the zvol, bypassing inventory cache
+func zvolFlag(zvol string) (string, error) {
+	volumes, err := zfs.ListDatasetProps(zfs.Volume, zvol, false, 0, "custom:sflag")
+	if err != nil {
+		return "", err
+	}
+
+	for _, volume := range volumes {
+		if volume["name"] == zvol {
+			return volume["custom:sflag"], nil
+		}
+	}
+	return "", nil
+}
+
+// isUnsetFlag - zvol without service flag. zfs reports unset user property as "-"
+func isUnsetFlag(sflag string) bool {
+	return sflag == "" || sflag == "-"
+}
+
+// MigrateUnflaggedVolumes - tag as managed clones created by earlier
+// versions, which didn't flag clones. Only zvols proven to be created by
+// znstor are tagged: clone of the snapshot of managed zvol of the same
+// project, exported as logical unit with alias equal to the zvol name.
+// Other unflagged zvols (ex: exported by administrator) stay unmanaged
+// and could be adopted.
+func MigrateUnflaggedVolumes() error {
+	volumes, err := zfs.ListDatasetProps(zfs.Volume, "", true, 0, "custom:sflag", "origin")
+	if err != nil {
+		return err
+	}
+
+	lus, err := stmf.ListLUs("")
+	if err != nil {
+		return err
+	}
+
+	aliases := make(map[string]string)
+	for _, lu := range lus {
+		aliases[lu.GetZvol()] = lu.Alias
+	}
+
+	sflags := make(map[string]string)
+	for _, volume := range volumes {
+		sflags[volume["name"]] = volume["custom:sflag"]
+	}
+
+	for _, volume := range volumes {
+		zvol := volume["name"]
+
+		if !isUnsetFlag(volume["custom:sflag"]) || aliases[zvol] != path.Base(zvol) {
+			continue
+		}
+		if strings.Count(zvol, "/") != 3 || isPrivatePool(poolOfDataset(zvol)) {
+			continue
+		}
+
+		origin := strings.SplitN(volume["origin"], "@", 2)[0]
+		if path.Dir(origin) != path.Dir(zvol) || !isManagedFlag(sflags[origin]) {
+			continue
+		}
+
+		if err := tagManagedZvol(zvol); err != nil {
+			log.Printf("migrate: can't tag zvol %s as managed. Err: %s", zvol, err.Error())
+			continue
+		}
+		log.Printf("migrate: clone %s of %s tagged as managed", zvol, volume["origin"])
+	}
+
+	return nil
+}
+
+// tagManagedZvol - set managed flag on zvol without service flag
+func tagManagedZvol(zvol string) error {
+	unlock := locks.Lock(zvolLockKey(zvol))
+	defer unlock()
+
+	sflag, err := zvolFlag(zvol)
+	if err != nil {
+		return err
+	}
+
+	// flag was changed after listing
+	if !isUnsetFlag(sflag) {
+		return nil
+	}
+
+	zfsVolume := &zfs.Dataset{Dataset: zvol}
+	if err := zfsVolume.SetProp("custom:sflag", sflagManaged); err != nil {
+		return err
+	}
+	inv.SetZvolProp(zvol, "custom:sflag", sflagManaged)
+
+	return nil
+}
+
+// ListUnmanagedVolumes - zvols under domain dataset (pool/domain) which are
+// not managed by znstor, with logical units based on them.
+func ListUnmanagedVolumes(domainPath string) ([]UnmanagedVolume, error) {
+	volumes, err := zfs.ListDatasetProps(zfs.Volume, domainPath, true, 0, "custom:sflag", "volsize")
+	if err != nil {
+		return nil, err
+	}
+
+	lus, err := stmf.ListLUs("")
+	if err != nil {
+		return nil, err
+	}
+
+	luByZvol := make(map[string]string)
+	for _, lu := range lus {
+		luByZvol[lu.GetZvol()] = lu.LUName
+	}
+
+	var unmanaged = make([]UnmanagedVolume, 0)
+	for _, volume := range volumes {
+		if isManagedFlag(volume["custom:sflag"]) {
+			continue
+		}
+
+		volsize, _ := strconv.ParseUint(volume["volsize"], 10, 64)
+		unmanaged = append(unmanaged, UnmanagedVolume{
+			Zvol:    volume["name"],
+			VolSize: volsize,
+			LUName:  luByZvol[volume["name"]],
+		})
+	}
+
+	return unmanaged, nil
+}
+
+// ListUnmanagedLUs - logical units based on unmanaged zvols under domain dataset
+func ListUnmanagedLUs(domainPath string) ([]*stmf.LogicalUnit, error) {
+	volumes, err := zfs.ListDatasetProps(zfs.Volume, domainPath, true, 0, "custom:sflag")
+	if err != nil {
+		return nil, err
+	}
+
+	unmanagedZvols := make(map[string]bool)
+	for _, volume := range volumes {
+		if !isManagedFlag(volume["custom:sflag"]) {
+			unmanagedZvols[volume["name"]] = true
+		}
+	}
+
+	lus, err := stmf.ListLUs("")
+	if err != nil {
+		return nil, err
+	}
+
+	var unmanaged = make([]*stmf.LogicalUnit, 0)
+	for _, lu := range lus {
+		if strings.HasPrefix(lu.DataFile, stmf.RDSK_DEFAULT_PREFIX) && unmanagedZvols[lu.GetZvol()] {
+			unmanaged = append(unmanaged, lu)
+		}
+	}
+
+	return unmanaged, nil
+}
+
+// VolAdopt - take unmanaged zvol under management. Zvol is tagged as managed,
+// logical unit is created if zvol is not exported yet (existing LU and its GUID
+// are kept), then volume is moved into the project.
+func VolAdopt(basepath, zvol string, force bool) (*stmf.LogicalUnit, error) {
+	if poolOfDataset(zvol) != poolOfDataset(basepath) {
+		return nil, &Error{
+			Err:    errors.New("Zvol belongs to another pool"),
+			Debug:  fmt.Sprintf("zvol: %s, project: %s", zvol, basepath),
+			Stderr: "",
+		}
+	}
+
+	moveRequired := path.Dir(zvol) != basepath
+
+	// volume in use can't be moved into project without force
+	if moveRequired && !force {
+		lu, err := lookupLuByZvol(zvol)
+		if err != nil {
+			return nil, err
+		}
+
+		if lu != nil {
+			if err := checkNoSessions(lu); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// zvol outside of project isn't counted in its provisioning yet. Adoption
+	// is refused before zvol is tagged, VolMove checks it again under lock.
+	if moveRequired {
+		if err := checkAdoptProvisioning(basepath, zvol); err != nil {
+			return nil, err
+		}
+	}
+
+	lu, adopted, err := adoptZvol(zvol)
+	if err != nil {
+		return nil, err
+	}
+
+	if !moveRequired {
+		return lu, nil
+	}
+
+	movedLu, err := VolMove(lu.LUName, basepath, force)
+	if err != nil {
+		if undoErr := undoAdoptZvol(zvol, lu, adopted); undoErr != nil {
+			log.Printf("Can't undo adoption of zvol %s. Err: %s", zvol, undoErr.Error())
+		}
+		return nil, err
+	}
+
+	return movedLu, nil
+}
+
+// adoption - changes made by adoptZvol
+type adoption struct {
+	// service flag of the zvol before adoption
+	sflag string
+	// logical unit was created by adoption
+	luCreated bool
+}
+
+// undoAdoptZvol - return zvol, which wasn't moved into project, to unmanaged
+// state: restore its service flag and delete logical unit created by adoption.
+// Zvol moved despite of error stays managed.
+func undoAdoptZvol(zvol string, lu *stmf.LogicalUnit, adopted adoption) error {
+	unlock := locks.Lock(luLockKey(lu.LUName), zvolLockKey(zvol))
+	defer unlock()
+
+	if _, err := zvolFlag(zvol); err != nil {
+		if errors.Is(err, zfs.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	if adopted.luCreated {
+		unlockComstar := locks.LockComstar()
+		err := lu.Delete(false)
+		unlockComstar()
+		if err != nil && !errors.Is(err, stmf.ErrNotFound) {
+			return err
+		}
+		inv.RemoveLu(lu.LUName)
+	}
+
+	return restoreZvolFlag(zvol, adopted.sflag)
+}
+
+// restoreZvolFlag - set service flag saved before adoption.
+// Caller must hold zvol lock.
+func restoreZvolFlag(zvol, sflag string) error {
+	zfsVolume := &zfs.Dataset{Dataset: zvol}
+
+	if isUnsetFlag(sflag) {
+		if err := zfsVolume.InheritProp("custom:sflag"); err != nil {
+			return err
+		}
+		// zfs reports unset user property as "-"
+		inv.SetZvolProp(zvol, "custom:sflag", "-")
+		return nil
+	}
+
+	if err := zfsVolume.SetProp("custom:sflag", sflag); err != nil {
+		return err
+	}
+	inv.SetZvolProp(zvol, "custom:sflag", sflag)
+
+	return nil
+}
+
+// checkAdoptProvisioning - check that project could provision adopted zvol
+func checkAdoptProvisioning(basepath, zvol string) error {
+	volumes, err := zfs.ListDatasetProps(zfs.Volume, zvol, false, 0, "volsize")
+	if err != nil {
+		return err
+	}
+
+	var volsize uint64
+	for _, volume := range volumes {
+		volsize += parseUintProp(volume["volsize"])
+	}
+
+	unlock := locks.Lock(projectLockKey(basepath))
+	defer unlock()
+
+	return checkProvisioning(basepath, volsize)
+}
+
+// adoptZvol - tag zvol as managed and ensure it is exported as logical unit.
+// Returns changes made, so adoption could be undone.
+func adoptZvol(zvol string) (*stmf.LogicalUnit, adoption, error) {
+	unlock := locks.Lock(zvolLockKey(zvol))
+	defer unlock()
+
+	var adopted adoption
+
+	zfsVolume, err := zfs.GetDataset(zvol)
+	if err != nil {
+		return nil, adopted, err
+	}
+
+	if err := zfsVolume.RefreshProps(); err != nil {
+		return nil, adopted, err
+	}
+
+	volume, ok := zfsVolume.Props.(*zfs.VolDataset)
+	if !ok {
+		return nil, adopted, &Error{
+			Err:    errors.New("Dataset is not a volume"),
+			Debug:  "dataset: " + zvol,
+			Stderr: "",
+		}
+	}
+
+	if isManagedFlag(volume.SFlag) {
+		return nil, adopted, &Error{
+			Err:    errors.New("Volume already managed"),
+			Debug:  "zvol: " + zvol,
+			Stderr: "",
+		}
+	}
+
+	lu, err := lookupLuByZvol(zvol)
+	if err != nil {
+		return nil, adopted, err
+	}
+
+	if err := zfsVolume.SetProp("custom:sflag", sflagManaged); err != nil {
+		return nil, adopted, err
+	}
+	inv.SetZvolProp(zvol, "custom:sflag", sflagManaged)
+	adopted.sflag = volume.SFlag
+
+	if lu == nil {
+		unlockComstar := locks.LockComstar()
+		lu, err = stmf.CreateLuWithProps(zvol, stmf.LuProperties{Alias: path.Base(zvol)})
+		unlockComstar()
+		if err != nil {
+			if restoreErr := restoreZvolFlag(zvol, adopted.sflag); restoreErr != nil {
+				log.Printf("Can't restore service flag of %s. Err: %s", zvol, restoreErr.Error())
+			}
+			return nil, adopted, err
+		}
+		adopted.luCreated = true
+	}
+	inv.UpdateLu(lu)
+
+	return lu, adopted, nil
+}
+
+// VolRelease - detach volume from management. Zvol and logical unit are kept.
+// Zvol is flagged as released, so it isn't tagged back as managed on startup.
+func VolRelease(lu_uuid string) error {
+	lu, err := stmf.GetLu(lu_uuid)
+	if err != nil {
+		return err
+	}
+
+	unlock := locks.Lock(luLockKey(lu.LUName), zvolLockKey(lu.GetZvol()))
+	defer unlock()
+
+	zfsVolume := &zfs.Dataset{Dataset: lu.GetZvol()}
+	if err := zfsVolume.SetProp("custom:sflag", sflagReleased); err != nil {
+		return err
+	}
+	inv.SetZvolProp(zfsVolume.Dataset, "custom:sflag", sflagReleased)
+
+	return nil
+}
@@ -0,0 +1,298 @@
+package znstor
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/d-helios/znstord/stmf"
+	"github.com/d-helios/znstord/zfs"
+)
+
+// Batch operations
+const (
+	batchOpCreate   = "create"
+	batchOpSnapshot = "snapshot"
+	batchOpExport   = "export"
+	batchOpUnexport = "unexport"
+	batchOpDelete   = "delete"
+)
+
+// Batch item states
+const (
+	batchItemDone           = "done"
+	batchItemFailed         = "failed"
+	batchItemSkipped        = "skipped"
+	batchItemRolledBack     = "rolled back"
+	batchItemRollbackFailed = "rollback failed"
+)
+
+// batchItem - prepared operation and its compensating action
+type batchItem struct {
+	op       BatchOperation
+	lu       *stmf.LogicalUnit
+	result   *BatchItemResult
+	undo     func() error // compensating action, set when operation is done
+	complete func() error // deferred part of operation, run when batch is committed
+}
+
+// prepareBatch - check operations and resolve volumes of the project.
+// Returns prepared items and keys of all locks required by the batch.
+func prepareBatch(basepath string, req BatchRequest) ([]*batchItem, []string, error) {
+	if len(req.Operations) == 0 {
+		return nil, nil, &Error{
+			Err:    fmt.Errorf("Batch has no operations"),
+			Debug:  "",
+			Stderr: "",
+		}
+	}
+
+	var items []*batchItem
+	var keys []string
+
+	for i, op := range req.Operations {
+		item := &batchItem{
+			op:     op,
+			result: &BatchItemResult{Index: i, Op: op.Op, Volume: op.Volume, Status: batchItemSkipped},
+		}
+
+		itemError := func(format string, args ...interface{}) error {
+			return &Error{
+				Err:    fmt.Errorf("operation %d (%s): %s", i, op.Op, fmt.Sprintf(format, args...)),
+				Debug:  fmt.Sprintf("operation: %+v", op),
+				Stderr: "",
+			}
+		}
+
+		// failure of the operation keeps code of the cause, details are logged
+		itemFailure := func(err error) error {
+			log.Printf("batch: operation %d (%s) failed. Err: %s", i, op.Op, err)
+			code, message := publicError(err)
+			return &Error{
+				Err:    fmt.Errorf("operation %d (%s): %s", i, op.Op, message),
+				Debug:  fmt.Sprintf("operation: %+v", op),
+				Stderr: "",
+				Kind:   code,
+			}
+		}
+
+		switch op.Op {
+		case batchOpCreate:
+			if op.Create == nil {
+				return nil, nil, itemError("create options not specified")
+			}
+			create, err := prepareVolumeCreate(basepath, *op.Create)
+			if err != nil {
+				return nil, nil, itemFailure(err)
+			}
+			item.op.Create = &create
+			keys = append(keys, volumeCreateLockKeys(basepath, create)...)
+			items = append(items, item)
+			continue
+		case batchOpSnapshot:
+			if op.Snapshot == "" {
+				return nil, nil, itemError("snapshot name not specified")
+			}
+		case batchOpExport, batchOpUnexport:
+			if op.Export == nil {
+				return nil, nil, itemError("export options not specified")
+			}
+			keys = append(keys, exportLockKeys([]ExportRequest{*op.Export})...)
+		case batchOpDelete:
+		default:
+			return nil, nil, itemError("unsupported operation")
+		}
+
+		lu, err := stmf.GetLu(op.Volume)
+		if err != nil {
+			return nil, nil, itemFailure(err)
+		}
+
+		if !IsVolumeBelongsToProject(basepath, *lu) {
+			return nil, nil, itemError("volume not found in specified project")
+		}
+
+		item.lu = lu
+		keys = append(keys, luLockKey(lu.LUName), zvolLockKey(lu.GetZvol()))
+		items = append(items, item)
+	}
+
+	return items, keys, nil
+}
+
+// RunBatch - run operations on volumes of the project with one lock acquisition.
+// In atomic mode batch stops on the first failure and compensating actions of
+// completed operations are run in reverse order. Volume delete is irreversible,
+// so in atomic mode volumes are only marked as deleting and destroyed after all
+// operations succeeded.
+func RunBatch(basepath string, req BatchRequest) (*BatchResult, error) {
+	items, keys, err := prepareBatch(basepath, req)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock := locks.Lock(keys...)
+	defer unlock()
+
+	result := &BatchResult{Atomic: req.Atomic, Status: batchItemDone}
+	for _, item := range items {
+		result.Items = append(result.Items, item.result)
+	}
+
+	var failed error
+	var done []*batchItem
+
+	for _, item := range items {
+		err := runBatchItem(basepath, item, req.Atomic)
+		if err != nil {
+			log.Printf("batch: operation %d (%s) failed. Err: %s", item.result.Index, item.op.Op, err.Error())
+			item.result.fail(batchItemFailed, err)
+			if failed == nil {
+				failed = err
+			}
+
+			if req.Atomic {
+				break
+			}
+			continue
+		}
+
+		item.result.Status = batchItemDone
+		done = append(done, item)
+	}
+
+	if failed != nil && req.Atomic {
+		result.Status = batchItemRolledBack
+
+		for i := len(done) - 1; i >= 0; i-- {
+			item := done[i]
+			if item.undo == nil {
+				continue
+			}
+
+			if err := item.undo(); err != nil {
+				log.Printf("batch: rollback of operation %d (%s) failed. Err: %s", item.result.Index, item.op.Op, err.Error())
+				item.result.fail(batchItemRollbackFailed, err)
+				result.Status = batchItemRollbackFailed
+				continue
+			}
+			item.result.Status = batchItemRolledBack
+		}
+
+		return result, failed
+	}
+
+	// commit deferred parts of operations
+	for _, item := range done {
+		if item.complete == nil {
+			continue
+		}
+
+		if err := item.complete(); err != nil {
+			log.Printf("batch: operation %d (%s) failed. Err: %s", item.result.Index, item.op.Op, err.Error())
+			item.result.fail(batchItemFailed, err)
+			if failed == nil {
+				failed = err
+			}
+		}
+	}
+
+	if failed != nil {
+		result.Status = batchItemFailed
+	}
+
+	return result, failed
+}
+
+// fail - set status of the failed operation with code and message of the
+// error. Debug details of the error are not reported.
+func (result *BatchItemResult) fail(status string, err error) {
+	result.Status = status
+	result.Code, result.Error = publicError(err)
+}
+
+// runBatchItem - run single operation and set its compensating action.
+// Caller must hold batch locks.
+func runBatchItem(basepath string, item *batchItem, atomic bool) error {
+	switch item.op.Op {
+	case batchOpCreate:
+		lu, err := createVolume(basepath, *item.op.Create)
+		if err != nil {
+			return err
+		}
+		item.lu = lu
+		item.result.Volume = lu.LUName
+		item.result.Result = inv.Volume(lu)
+		item.undo = func() error {
+			if err := markVolDeleting(lu.GetZvol()); err != nil {
+				return err
+			}
+			return resumeVolDestroy(lu.GetZvol())
+		}
+
+	case batchOpSnapshot:
+		zfsVolume := &zfs.Dataset{Dataset: item.lu.GetZvol()}
+		snapshot, err := zfsVolume.Snapshot(item.op.Snapshot)
+		if err != nil {
+			return err
+		}
+		item.result.Result = snapshot
+		item.undo = func() error {
+			return snapshot.DestroyWithFlags(zfs.DestroyFlags{})
+		}
+
+	case batchOpExport:
+		lu := item.lu
+		view, err := addView(lu, *item.op.Export)
+		if err != nil {
+			return err
+		}
+		item.result.Result = view
+		item.undo = func() error {
+			unlockComstar := locks.LockComstar()
+			defer unlockComstar()
+			defer inv.UpdateLu(lu)
+			return lu.RemoveView(view.ViewEntry)
+		}
+
+	case batchOpUnexport:
+		lu := item.lu
+		view, err := lu.GetViewEntry(item.op.Export.Hostgroup, item.op.Export.Targetgroup)
+		if err != nil {
+			return err
+		}
+		unlockComstar := locks.LockComstar()
+		err = lu.RemoveView(view.ViewEntry)
+		unlockComstar()
+		inv.UpdateLu(lu)
+		if err != nil {
+			return err
+		}
+		item.result.Result = view
+		item.undo = func() error {
+			unlockComstar := locks.LockComstar()
+			defer unlockComstar()
+			defer inv.UpdateLu(lu)
+			_, err := lu.AddView(view.HostGroup, view.TargetGroup, int64(view.LUN))
+			return err
+		}
+
+	case batchOpDelete:
+		zvol := item.lu.GetZvol()
+		if err := markVolDeleting(zvol); err != nil {
+			return err
+		}
+
+		if !atomic {
+			return resumeVolDestroy(zvol)
+		}
+
+		item.undo = func() error {
+			return markVolManaged(zvol)
+		}
+		item.complete = func() error {
+			return resumeVolDestroy(zvol)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package znstor
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+
+	"github.com/d-helios/znstord/zfs"
+)
+
+// projectCapacity - provisioning and space usage of project volumes
+func projectCapacity(basepath string) (*ProjectCapacity, error) {
+	projects, err := zfs.ListDatasetProps(zfs.Filesystem, basepath, false, 0,
+		"quota", "used", "available", propMaxProvisioned, propOvercommitRatio)
+	if err != nil {
+		return nil, err
+	}
+	if len(projects) == 0 {
+		return nil, &Error{
+			Err:    fmt.Errorf("Project %s not found", basepath),
+			Kind:   codeNotFound,
+			Debug:  "",
+			Stderr: "",
+		}
+	}
+	project := projects[0]
+
+	capacity := &ProjectCapacity{
+		Project:         path.Base(basepath),
+		Quota:           parseUintProp(project["quota"]),
+		Used:            parseUintProp(project["used"]),
+		Available:       parseUintProp(project["available"]),
+		MaxProvisioned:  parseUintProp(project[propMaxProvisioned]),
+		OvercommitRatio: parseRatioProp(project[propOvercommitRatio]),
+	}
+
+	zvols, err := zfs.ListDatasetProps(zfs.Volume, basepath, true, 0, "volsize", "usedbysnapshots")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, zvol := range zvols {
+		capacity.Volumes++
+		capacity.Provisioned += parseUintProp(zvol["volsize"])
+		capacity.UsedBySnapshots += parseUintProp(zvol["usedbysnapshots"])
+	}
+
+	capacity.ProvisionLimit = provisionLimit(capacity)
+
+	return capacity, nil
+}
+
+// provisionLimit - effective limit of provisioned bytes, 0 if project is unlimited.
+// The lowest of max provisioned bytes and quota multiplied by overcommit ratio is used.
+// Project without quota could use space available to its parent, so overcommit
+// ratio is applied to used and available space of the project.
+func provisionLimit(capacity *ProjectCapacity) uint64 {
+	limit := capacity.MaxProvisioned
+
+	if capacity.OvercommitRatio > 0 {
+		space := capacity.Quota
+		if space == 0 {
+			space = capacity.Used + capacity.Available
+		}
+
+		ratioLimit := uint64(float64(space) * capacity.OvercommitRatio)
+		if limit == 0 || ratioLimit < limit {
+			limit = ratioLimit
+		}
+	}
+	return limit
+}
+
+// checkProvisioning - check that project could provision additional bytes.
+// Caller must hold project lock.
+func checkProvisioning(basepath string, delta uint64) error {
+	capacity, err := projectCapacity(basepath)
+	if err != nil {
+		return err
+	}
+
+	if capacity.ProvisionLimit == 0 {
+		return nil
+	}
+
+	if capacity.Provisioned+delta > capacity.ProvisionLimit {
+		return &Error{
+			Err: fmt.Errorf("Project provisioning limit exceeded: %d bytes provisioned, %d bytes requested, limit is %d bytes",
+				capacity.Provisioned, delta, capacity.ProvisionLimit),
+			Debug:  fmt.Sprintf("project: %s, capacity: %+v", basepath, *capacity),
+			Stderr: "",
+		}
+	}
+	return nil
+}
+
+// setProjectLimits - store provisioning limits as project user properties.
+// Zero value removes the limit.
+func setProjectLimits(dataset *zfs.Dataset, req FilesystemRequest) error {
+	if req.MaxProvisioned != nil {
+		var err error
+		if *req.MaxProvisioned == 0 {
+			err = dataset.InheritProp(propMaxProvisioned)
+		} else {
+			err = dataset.SetProp(propMaxProvisioned, strconv.FormatUint(*req.MaxProvisioned, 10))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if req.OvercommitRatio != nil {
+		if *req.OvercommitRatio < 0 {
+			return &Error{
+				Err:    fmt.Errorf("Invalid overcommit ratio %v", *req.OvercommitRatio),
+				Debug:  "",
+				Stderr: "",
+			}
+		}
+
+		var err error
+		if *req.OvercommitRatio == 0 {
+			err = dataset.InheritProp(propOvercommitRatio)
+		} else {
+			err = dataset.SetProp(propOvercommitRatio, strconv.FormatFloat(*req.OvercommitRatio, 'f', -1, 64))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseRatioProp(ratio string) float64 {
+	value, _ := strconv.ParseFloat(ratio, 64)
+	return value
+}
@@ -0,0 +1,27 @@
+package znstor
+
+import (
+	"testing"
+)
+
+func TestProvisionLimit(t *testing.T) {
+	tests := []struct {
+		capacity ProjectCapacity
+		limit    uint64
+	}{
+		{ProjectCapacity{Quota: 100, Used: 10, Available: 90}, 0},
+		{ProjectCapacity{Quota: 100, MaxProvisioned: 150}, 150},
+		{ProjectCapacity{Quota: 100, OvercommitRatio: 2}, 200},
+		{ProjectCapacity{Quota: 100, OvercommitRatio: 2, MaxProvisioned: 150}, 150},
+		{ProjectCapacity{Quota: 100, OvercommitRatio: 1.5, MaxProvisioned: 300}, 150},
+		{ProjectCapacity{Used: 40, Available: 60, OvercommitRatio: 3}, 300},
+		{ProjectCapacity{Used: 40, Available: 60, OvercommitRatio: 0.5, MaxProvisioned: 80}, 50},
+		{ProjectCapacity{Used: 40, Available: 60}, 0},
+	}
+
+	for _, test := range tests {
+		if limit := provisionLimit(&test.capacity); limit != test.limit {
+			t.Errorf("%+v: limit %d, expected %d", test.capacity, limit, test.limit)
+		}
+	}
+}
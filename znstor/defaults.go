@@ -0,0 +1,135 @@
+package znstor
+
+import (
+	"strconv"
+
+	"github.com/d-helios/znstord/zfs"
+)
+
+// Project defaults are stored as user properties of the project dataset.
+// User properties are inherited, so defaults set on domain apply to all its projects.
+const (
+	propDefaultVolBlockSize = "custom:default_volblocksize"
+	propDefaultCompression  = "custom:default_compression"
+	propDefaultDedup        = "custom:default_dedup"
+	propDefaultThin         = "custom:default_thin"
+	propDefaultLuBlockSize  = "custom:default_lu_blocksize"
+	propDefaultWriteCache   = "custom:default_writecache"
+	propDefaultHostgroup    = "custom:default_hostgroup"
+	propDefaultTargetgroup  = "custom:default_targetgroup"
+)
+
+var projectDefaultsProps = []string{
+	propDefaultVolBlockSize,
+	propDefaultCompression,
+	propDefaultDedup,
+	propDefaultThin,
+	propDefaultLuBlockSize,
+	propDefaultWriteCache,
+	propDefaultHostgroup,
+	propDefaultTargetgroup,
+}
+
+// getProjectDefaults - read volume defaults of the project
+func getProjectDefaults(basepath string) (*ProjectDefaults, error) {
+	datasets, err := zfs.ListDatasetProps(zfs.Filesystem, basepath, false, 0, projectDefaultsProps...)
+	if err != nil {
+		return nil, err
+	}
+
+	defaults := &ProjectDefaults{}
+	if len(datasets) == 0 {
+		return defaults, nil
+	}
+
+	props := datasets[0]
+	value := func(prop string) string {
+		// unset user property is reported as "-"
+		if props[prop] == "-" {
+			return ""
+		}
+		return props[prop]
+	}
+
+	defaults.VolBlockSize = parseUintProp(value(propDefaultVolBlockSize))
+	defaults.Compression = value(propDefaultCompression)
+	defaults.Dedup = value(propDefaultDedup)
+	defaults.Thin = parseBoolProp(value(propDefaultThin))
+	defaults.LuBlockSize = parseUintProp(value(propDefaultLuBlockSize))
+	defaults.WriteCache = parseBoolProp(value(propDefaultWriteCache))
+	defaults.Hostgroup = value(propDefaultHostgroup)
+	defaults.Targetgroup = value(propDefaultTargetgroup)
+
+	return defaults, nil
+}
+
+// setProjectDefaults - replace volume defaults of the project.
+// Omitted values are removed from the project.
+func setProjectDefaults(basepath string, defaults ProjectDefaults) error {
+	dataset, err := zfs.GetDataset(basepath)
+	if err != nil {
+		return err
+	}
+
+	values := map[string]string{
+		propDefaultCompression: defaults.Compression,
+		propDefaultDedup:       defaults.Dedup,
+		propDefaultHostgroup:   defaults.Hostgroup,
+		propDefaultTargetgroup: defaults.Targetgroup,
+	}
+	if defaults.VolBlockSize != 0 {
+		values[propDefaultVolBlockSize] = strconv.FormatUint(defaults.VolBlockSize, 10)
+	}
+	if defaults.Thin != nil {
+		values[propDefaultThin] = strconv.FormatBool(*defaults.Thin)
+	}
+	if defaults.LuBlockSize != 0 {
+		values[propDefaultLuBlockSize] = strconv.FormatUint(defaults.LuBlockSize, 10)
+	}
+	if defaults.WriteCache != nil {
+		values[propDefaultWriteCache] = strconv.FormatBool(*defaults.WriteCache)
+	}
+
+	for _, prop := range projectDefaultsProps {
+		if values[prop] == "" {
+			err = dataset.InheritProp(prop)
+		} else {
+			err = dataset.SetProp(prop, values[prop])
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyProjectDefaults - fill volume options omitted in request with project defaults
+func applyProjectDefaults(options ZVolOptions, defaults *ProjectDefaults) ZVolOptions {
+	if options.VolBlockSize == 0 {
+		options.VolBlockSize = defaults.VolBlockSize
+	}
+	if options.Compression == "" {
+		options.Compression = defaults.Compression
+	}
+	if options.Dedup == "" {
+		options.Dedup = defaults.Dedup
+	}
+	if options.Thin == nil {
+		options.Thin = defaults.Thin
+	}
+	if options.LuBlockSize == 0 {
+		options.LuBlockSize = defaults.LuBlockSize
+	}
+	if options.WriteCache == nil {
+		options.WriteCache = defaults.WriteCache
+	}
+	return options
+}
+
+func parseBoolProp(value string) *bool {
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil
+	}
+	return &parsed
+}
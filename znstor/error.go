@@ -1,15 +1,74 @@
 package znstor
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // Error structure
 type Error struct {
 	Err    error
 	Debug  string
 	Stderr string
+	Kind   string
 }
 
 // returns the string representation of an Error.
 func (e Error) Error() string {
 	return fmt.Sprintf("%s: %q => %s", e.Err, e.Debug, e.Stderr)
 }
+
+// ErrorKind - machine readable class of the error. Empty if not classified.
+func (e Error) ErrorKind() string {
+	return e.Kind
+}
+
+// Message - error description without debug details
+func (e Error) Message() string {
+	if e.Err == nil {
+		return e.Kind
+	}
+	return e.Err.Error()
+}
+
+// ValidationError - field level errors of the request
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	var fields []string
+	for _, field := range e.Fields {
+		fields = append(fields, field.Field+": "+field.Message)
+	}
+	return "Invalid request: " + strings.Join(fields, "; ")
+}
+
+// ErrorKind - validation errors are always invalid arguments
+func (e *ValidationError) ErrorKind() string {
+	return codeInvalidArgument
+}
+
+// Message - names of the invalid fields. Details are reported per field
+func (e *ValidationError) Message() string {
+	var fields []string
+	for _, field := range e.Fields {
+		fields = append(fields, field.Field)
+	}
+	return "Invalid request fields: " + strings.Join(fields, ", ")
+}
+
+// check - record error of the field, if message is not empty
+func (e *ValidationError) check(field, message string) {
+	if message != "" {
+		e.Fields = append(e.Fields, FieldError{Field: field, Message: message})
+	}
+}
+
+// err - nil if no errors were recorded
+func (e *ValidationError) err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
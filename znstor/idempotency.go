@@ -0,0 +1,160 @@
+package znstor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotencyReplayedHeader = "Idempotent-Replayed"
+)
+
+// idempotencyEntry - response of the request with Idempotency-Key
+type idempotencyEntry struct {
+	fingerprint string
+	done        bool
+	status      int
+	contentType string
+	body        []byte
+	expires     time.Time
+}
+
+// idempotencyStore - responses of creating requests, kept for the window
+// so that client retries get the original result instead of a duplicate.
+type idempotencyStore struct {
+	mu      sync.Mutex
+	window  time.Duration
+	entries map[string]*idempotencyEntry
+}
+
+var idempotency = &idempotencyStore{
+	window:  idempotencyDefaultWindow,
+	entries: make(map[string]*idempotencyEntry),
+}
+
+// ConfigureIdempotencyWindow - set how long responses of requests with
+// Idempotency-Key are kept. Zero keeps default window.
+func ConfigureIdempotencyWindow(seconds uint64) {
+	if seconds == 0 {
+		return
+	}
+
+	idempotency.mu.Lock()
+	idempotency.window = time.Duration(seconds) * time.Second
+	idempotency.mu.Unlock()
+}
+
+// begin - register request. Returns stored entry if key is already known
+func (store *idempotencyStore) begin(key, fingerprint string) (*idempotencyEntry, bool) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := time.Now()
+	for k, entry := range store.entries {
+		if entry.done && now.After(entry.expires) {
+			delete(store.entries, k)
+		}
+	}
+
+	if entry, ok := store.entries[key]; ok {
+		return entry, true
+	}
+
+	store.entries[key] = &idempotencyEntry{fingerprint: fingerprint}
+	return nil, false
+}
+
+// finish - store response of the request.
+// Server errors are not stored, so request could be retried with the same key
+func (store *idempotencyStore) finish(key string, recorder *responseRecorder) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if recorder.status >= http.StatusInternalServerError {
+		delete(store.entries, key)
+		return
+	}
+
+	entry := store.entries[key]
+	entry.done = true
+	entry.status = recorder.status
+	entry.contentType = recorder.Header().Get("Content-Type")
+	entry.body = recorder.body.Bytes()
+	entry.expires = time.Now().Add(store.window)
+}
+
+// responseRecorder - pass response to client and keep its copy
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (recorder *responseRecorder) WriteHeader(status int) {
+	recorder.status = status
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+func (recorder *responseRecorder) Write(data []byte) (int, error) {
+	recorder.body.Write(data)
+	return recorder.ResponseWriter.Write(data)
+}
+
+// Idempotent - replay stored response of the request with the same Idempotency-Key.
+// Key is scoped by user. Reusing key with different request is refused.
+func Idempotent(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimSpace(r.Header.Get(idempotencyKeyHeader))
+		if key == "" {
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, batchPayloadMaxSize))
+		if err != nil {
+			sendError(w, traceFunctionName(), err)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		user, _, _ := r.BasicAuth()
+		hash := sha256.New()
+		// query options (ex: force, quiesce) change result of the request
+		hash.Write([]byte(r.Method + " " + r.URL.Path + "?" + r.URL.Query().Encode() + "\n"))
+		hash.Write(body)
+		fingerprint := hex.EncodeToString(hash.Sum(nil))
+
+		key = user + ":" + key
+
+		entry, found := idempotency.begin(key, fingerprint)
+		if found {
+			switch {
+			case entry.fingerprint != fingerprint:
+				sendCodedMessage(w, http.StatusUnprocessableEntity, traceFunctionName(), codeIdempotencyKeyReused,
+					"Idempotency-Key was already used with a different request")
+			case !entry.done:
+				sendCodedMessage(w, http.StatusConflict, traceFunctionName(), codeRequestInProgress,
+					"Request with the same Idempotency-Key is in progress")
+			default:
+				w.Header().Set("Content-Type", entry.contentType)
+				w.Header().Set(idempotencyReplayedHeader, "true")
+				w.WriteHeader(entry.status)
+				w.Write(entry.body)
+			}
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer idempotency.finish(key, recorder)
+
+		inner.ServeHTTP(recorder, r)
+	})
+}
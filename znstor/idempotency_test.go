@@ -0,0 +1,212 @@
+package znstor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withIdempotencyStore - run test with empty store of the specified window
+func withIdempotencyStore(window time.Duration) func() {
+	saved := idempotency
+	idempotency = &idempotencyStore{
+		window:  window,
+		entries: make(map[string]*idempotencyEntry),
+	}
+	return func() { idempotency = saved }
+}
+
+// countingHandler - responds with status and number of served requests
+func countingHandler(status int, calls *int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]int{"call": *calls})
+	})
+}
+
+func idempotentRequest(handler http.Handler, method, target, key, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.SetBasicAuth("user", "password")
+	if key != "" {
+		r.Header.Set(idempotencyKeyHeader, key)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func responseCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	var msg RespMsg
+	if err := json.NewDecoder(w.Body).Decode(&msg); err != nil {
+		t.Fatalf("can't decode response %q: %v", w.Body.String(), err)
+	}
+	return msg.Code
+}
+
+func TestIdempotentReplay(t *testing.T) {
+	defer withIdempotencyStore(time.Hour)()
+
+	calls := 0
+	handler := Idempotent(countingHandler(http.StatusCreated, &calls))
+
+	first := idempotentRequest(handler, "POST", "/volumes", "key-1", `{"alias":"vol1"}`)
+	second := idempotentRequest(handler, "POST", "/volumes", "key-1", `{"alias":"vol1"}`)
+
+	if calls != 1 {
+		t.Fatalf("handler called %d times, expected 1", calls)
+	}
+	if second.Code != http.StatusCreated || second.Body.String() != first.Body.String() {
+		t.Errorf("replayed %d %q, expected %d %q", second.Code, second.Body.String(), first.Code, first.Body.String())
+	}
+	if second.Header().Get(idempotencyReplayedHeader) != "true" {
+		t.Errorf("%s header not set on replayed response", idempotencyReplayedHeader)
+	}
+	if first.Header().Get(idempotencyReplayedHeader) != "" {
+		t.Errorf("%s header set on original response", idempotencyReplayedHeader)
+	}
+
+	// requests without key and keys of other users are not replayed
+	idempotentRequest(handler, "POST", "/volumes", "", `{"alias":"vol1"}`)
+
+	r := httptest.NewRequest("POST", "/volumes", strings.NewReader(`{"alias":"vol1"}`))
+	r.SetBasicAuth("other", "password")
+	r.Header.Set(idempotencyKeyHeader, "key-1")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	if calls != 3 {
+		t.Errorf("handler called %d times, expected 3", calls)
+	}
+}
+
+func TestIdempotentKeyReused(t *testing.T) {
+	defer withIdempotencyStore(time.Hour)()
+
+	calls := 0
+	handler := Idempotent(countingHandler(http.StatusCreated, &calls))
+
+	idempotentRequest(handler, "POST", "/volumes", "key-1", `{"alias":"vol1"}`)
+
+	tests := []struct {
+		method string
+		target string
+		body   string
+	}{
+		{"POST", "/volumes", `{"alias":"vol2"}`},
+		{"POST", "/volumes/other", `{"alias":"vol1"}`},
+		{"PUT", "/volumes", `{"alias":"vol1"}`},
+		{"POST", "/volumes?force=true", `{"alias":"vol1"}`},
+	}
+
+	for _, test := range tests {
+		w := idempotentRequest(handler, test.method, test.target, "key-1", test.body)
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s %s %s: status %d, expected %d", test.method, test.target, test.body, w.Code, http.StatusUnprocessableEntity)
+			continue
+		}
+		if code := responseCode(t, w); code != codeIdempotencyKeyReused {
+			t.Errorf("%s %s %s: code %q, expected %q", test.method, test.target, test.body, code, codeIdempotencyKeyReused)
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("handler called %d times, expected 1", calls)
+	}
+}
+
+func TestIdempotentQueryOrder(t *testing.T) {
+	defer withIdempotencyStore(time.Hour)()
+
+	calls := 0
+	handler := Idempotent(countingHandler(http.StatusOK, &calls))
+
+	idempotentRequest(handler, "PUT", "/volumes/vol1/rollback?quiesce=true&force=true", "key-1", "")
+	w := idempotentRequest(handler, "PUT", "/volumes/vol1/rollback?force=true&quiesce=true", "key-1", "")
+
+	if calls != 1 || w.Header().Get(idempotencyReplayedHeader) != "true" {
+		t.Errorf("request with reordered query not replayed: status %d, calls %d", w.Code, calls)
+	}
+}
+
+func TestIdempotentInProgress(t *testing.T) {
+	defer withIdempotencyStore(time.Hour)()
+
+	started := make(chan bool)
+	release := make(chan bool)
+	handler := Idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- true
+		<-release
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- idempotentRequest(handler, "POST", "/volumes", "key-1", `{"alias":"vol1"}`)
+	}()
+	<-started
+
+	w := idempotentRequest(handler, "POST", "/volumes", "key-1", `{"alias":"vol1"}`)
+	if w.Code != http.StatusConflict {
+		t.Errorf("status %d, expected %d", w.Code, http.StatusConflict)
+	} else if code := responseCode(t, w); code != codeRequestInProgress {
+		t.Errorf("code %q, expected %q", code, codeRequestInProgress)
+	}
+
+	close(release)
+	if first := <-done; first.Code != http.StatusCreated {
+		t.Errorf("first request status %d, expected %d", first.Code, http.StatusCreated)
+	}
+}
+
+func TestIdempotentServerErrorNotStored(t *testing.T) {
+	defer withIdempotencyStore(time.Hour)()
+
+	calls := 0
+	status := http.StatusInternalServerError
+	handler := Idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		countingHandler(status, &calls).ServeHTTP(w, r)
+	}))
+
+	if w := idempotentRequest(handler, "POST", "/volumes", "key-1", `{"alias":"vol1"}`); w.Code != status {
+		t.Fatalf("status %d, expected %d", w.Code, status)
+	}
+
+	// retry with the same key is served again
+	status = http.StatusCreated
+	w := idempotentRequest(handler, "POST", "/volumes", "key-1", `{"alias":"vol1"}`)
+	if w.Code != http.StatusCreated || calls != 2 {
+		t.Errorf("retry status %d, calls %d, expected %d and 2", w.Code, calls, http.StatusCreated)
+	}
+
+	// client errors are stored
+	status = http.StatusBadRequest
+	idempotentRequest(handler, "POST", "/volumes", "key-2", `{"alias":"vol1"}`)
+	w = idempotentRequest(handler, "POST", "/volumes", "key-2", `{"alias":"vol1"}`)
+	if w.Code != http.StatusBadRequest || calls != 3 {
+		t.Errorf("replayed status %d, calls %d, expected %d and 3", w.Code, calls, http.StatusBadRequest)
+	}
+}
+
+func TestIdempotentExpiry(t *testing.T) {
+	defer withIdempotencyStore(10 * time.Millisecond)()
+
+	calls := 0
+	handler := Idempotent(countingHandler(http.StatusCreated, &calls))
+
+	idempotentRequest(handler, "POST", "/volumes", "key-1", `{"alias":"vol1"}`)
+	time.Sleep(20 * time.Millisecond)
+
+	// after the window key could be used with any request
+	w := idempotentRequest(handler, "POST", "/volumes", "key-1", `{"alias":"vol2"}`)
+	if w.Code != http.StatusCreated || calls != 2 {
+		t.Errorf("status %d, calls %d, expected %d and 2", w.Code, calls, http.StatusCreated)
+	}
+	if w.Header().Get(idempotencyReplayedHeader) != "" {
+		t.Errorf("expired response replayed")
+	}
+}
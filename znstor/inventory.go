@@ -0,0 +1,335 @@
+package znstor
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/d-helios/znstord/stmf"
+	"github.com/d-helios/znstord/zfs"
+)
+
+// inventory - in-memory cache of logical units, views and zvols.
+// Cache is refreshed every inventoryRefreshInterval and updated by the
+// daemon's own mutations. Views are loaded on demand.
+type inventory struct {
+	mu         sync.RWMutex
+	valid      bool
+	generation uint64 // incremented by every mutation
+	refreshed  time.Time
+	lus        map[string]*stmf.LogicalUnit // GUID -> logical unit
+	projects   map[string]map[string]bool   // project dataset -> GUIDs
+	views      map[string][]stmf.View       // GUID -> views
+	zvols      map[string]map[string]string // zvol -> properties
+}
+
+// zvol properties stored in the inventory
+var inventoryZvolProps = []string{"custom:sflag", "creation"}
+
+var inv = newInventory()
+
+func newInventory() *inventory {
+	return &inventory{
+		lus:      make(map[string]*stmf.LogicalUnit),
+		projects: make(map[string]map[string]bool),
+		views:    make(map[string][]stmf.View),
+		zvols:    make(map[string]map[string]string),
+	}
+}
+
+// StartInventoryRefresh - periodically reload inventory cache.
+func StartInventoryRefresh() {
+	go func() {
+		for {
+			if err := inv.Refresh(); err != nil {
+				log.Printf("inventory: refresh failed. Err: %s", err.Error())
+			}
+			time.Sleep(inventoryRefreshInterval)
+		}
+	}()
+}
+
+// isFresh - client requested to bypass inventory cache (?fresh=true)
+func isFresh(r *http.Request) bool {
+	return r.URL.Query().Get("fresh") == "true"
+}
+
+// isQuiesce - client requested to take logical unit offline during operation (?quiesce=true)
+func isQuiesce(r *http.Request) bool {
+	return r.URL.Query().Get("quiesce") == "true"
+}
+
+func projectOfZvol(zvol string) string {
+	return path.Dir(zvol)
+}
+
+// Refresh - reload logical units and zvols.
+// Listing is retried if inventory was modified while listing. Error is
+// returned if inventory can't be loaded without concurrent modifications.
+func (inv *inventory) Refresh() error {
+	for attempt := 0; attempt < inventoryRefreshAttempts; attempt++ {
+		loaded, err := inv.load()
+		if err != nil || loaded {
+			return err
+		}
+	}
+
+	return &Error{
+		Err:    errors.New("Inventory modified during refresh, try again later"),
+		Debug:  fmt.Sprintf("attempts: %d", inventoryRefreshAttempts),
+		Stderr: "",
+		Kind:   codeBusy,
+	}
+}
+
+// load - list logical units and zvols and replace cached ones.
+// Returns false if inventory was modified while listing.
+func (inv *inventory) load() (bool, error) {
+	inv.mu.RLock()
+	generation := inv.generation
+	inv.mu.RUnlock()
+
+	lus, err := stmf.ListLUs("")
+	if err != nil {
+		return false, err
+	}
+
+	volumes, err := zfs.ListDatasetProps(zfs.Volume, "", true, 0, inventoryZvolProps...)
+	if err != nil {
+		return false, err
+	}
+
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	// inventory was modified while listing, loaded data may be stale
+	if inv.valid && inv.generation != generation {
+		return false, nil
+	}
+
+	inv.lus = make(map[string]*stmf.LogicalUnit)
+	inv.projects = make(map[string]map[string]bool)
+	inv.views = make(map[string][]stmf.View)
+	inv.zvols = make(map[string]map[string]string)
+
+	for _, lu := range lus {
+		inv.storeLu(lu)
+	}
+
+	for _, volume := range volumes {
+		inv.zvols[volume["name"]] = volume
+	}
+
+	inv.valid = true
+	inv.refreshed = time.Now()
+
+	return true, nil
+}
+
+func (inv *inventory) ensure(fresh bool) error {
+	inv.mu.RLock()
+	valid := inv.valid
+	inv.mu.RUnlock()
+
+	if fresh || !valid {
+		return inv.Refresh()
+	}
+	return nil
+}
+
+// storeLu - caller must hold write lock
+func (inv *inventory) storeLu(lu *stmf.LogicalUnit) {
+	guid := strings.ToUpper(lu.LUName)
+
+	if old, ok := inv.lus[guid]; ok {
+		delete(inv.projects[projectOfZvol(old.GetZvol())], guid)
+	}
+
+	copied := *lu
+	inv.lus[guid] = &copied
+
+	project := projectOfZvol(lu.GetZvol())
+	if inv.projects[project] == nil {
+		inv.projects[project] = make(map[string]bool)
+	}
+	inv.projects[project][guid] = true
+}
+
+// GetLu - get logical unit from inventory.
+// Logical units missing in inventory are loaded with stmfadm.
+func (inv *inventory) GetLu(guid string, fresh bool) (*stmf.LogicalUnit, error) {
+	if !fresh {
+		inv.mu.RLock()
+		lu, ok := inv.lus[strings.ToUpper(guid)]
+		inv.mu.RUnlock()
+
+		if ok {
+			copied := *lu
+			return &copied, nil
+		}
+	}
+
+	lu, err := stmf.GetLu(guid)
+	if err != nil {
+		return nil, err
+	}
+
+	inv.UpdateLu(lu)
+
+	return lu, nil
+}
+
+// ProjectVolumes - managed volumes which belongs to project
+func (inv *inventory) ProjectVolumes(basepath string, fresh bool) ([]Volume, error) {
+	if err := inv.ensure(fresh); err != nil {
+		return nil, err
+	}
+
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+
+	var volumes = make([]Volume, 0)
+	for guid := range inv.projects[basepath] {
+		lu := inv.lus[guid]
+		sflag := inv.zvols[lu.GetZvol()]["custom:sflag"]
+		if !isManagedFlag(sflag) {
+			continue
+		}
+		volumes = append(volumes, newVolume(lu, sflag))
+	}
+
+	return volumes, nil
+}
+
+// LogicalUnits - all cached logical units
+func (inv *inventory) LogicalUnits() []*stmf.LogicalUnit {
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+
+	lus := make([]*stmf.LogicalUnit, 0, len(inv.lus))
+	for _, lu := range inv.lus {
+		copied := *lu
+		lus = append(lus, &copied)
+	}
+	return lus
+}
+
+// Generation - number of mutations of inventory. Changed generation means
+// cached data read before could be stale.
+func (inv *inventory) Generation() uint64 {
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+
+	return inv.generation
+}
+
+// Volume - logical unit with the state of its zvol
+func (inv *inventory) Volume(lu *stmf.LogicalUnit) Volume {
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+
+	return newVolume(lu, inv.zvols[lu.GetZvol()]["custom:sflag"])
+}
+
+// ZvolProp - cached zvol property
+func (inv *inventory) ZvolProp(zvol, prop string) string {
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+
+	return inv.zvols[zvol][prop]
+}
+
+// Views - views of logical unit
+func (inv *inventory) Views(lu *stmf.LogicalUnit, fresh bool) ([]stmf.View, error) {
+	guid := strings.ToUpper(lu.LUName)
+
+	if !fresh {
+		inv.mu.RLock()
+		views, ok := inv.views[guid]
+		inv.mu.RUnlock()
+
+		if ok {
+			return views, nil
+		}
+	}
+
+	views, err := lu.ListView()
+	if err != nil {
+		return nil, err
+	}
+
+	inv.mu.Lock()
+	inv.views[guid] = views
+	inv.mu.Unlock()
+
+	return views, nil
+}
+
+// UpdateLu - store modified logical unit and drop its cached views
+func (inv *inventory) UpdateLu(lu *stmf.LogicalUnit) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	inv.generation++
+
+	inv.storeLu(lu)
+	delete(inv.views, strings.ToUpper(lu.LUName))
+}
+
+// RemoveLu - remove deleted logical unit
+func (inv *inventory) RemoveLu(guid string) {
+	guid = strings.ToUpper(guid)
+
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	inv.generation++
+
+	if lu, ok := inv.lus[guid]; ok {
+		delete(inv.projects[projectOfZvol(lu.GetZvol())], guid)
+	}
+	delete(inv.lus, guid)
+	delete(inv.views, guid)
+}
+
+// SetZvolProp - update cached zvol property
+func (inv *inventory) SetZvolProp(zvol, prop, value string) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	inv.generation++
+
+	if inv.zvols[zvol] == nil {
+		inv.zvols[zvol] = map[string]string{"name": zvol}
+	}
+	inv.zvols[zvol][prop] = value
+}
+
+// RenameZvol - move cached properties of renamed zvol
+func (inv *inventory) RenameZvol(oldZvol, newZvol string) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	inv.generation++
+
+	if props, ok := inv.zvols[oldZvol]; ok {
+		props["name"] = newZvol
+		inv.zvols[newZvol] = props
+		delete(inv.zvols, oldZvol)
+	}
+}
+
+// RemoveZvol - remove destroyed zvol
+func (inv *inventory) RemoveZvol(zvol string) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	inv.generation++
+
+	delete(inv.zvols, zvol)
+}
@@ -0,0 +1,74 @@
+package znstor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+
+	"github.com/twinj/uuid"
+)
+
+// startJob - run task in background and return job uuid.
+// Job status is tracked in asyncResultDir/<uuid>.status file.
+func startJob(task func() error) string {
+	return startJobWithResult(func() (interface{}, error) {
+		return nil, task()
+	})
+}
+
+// startJobWithResult - run task in background and return job uuid.
+// Status of the failed job is the error code and message separated by newline.
+// Besides job status, non nil task result is stored in json format in
+// asyncResultDir/<uuid>.result file.
+func startJobWithResult(task func() (interface{}, error)) string {
+	requestUuid := uuid.NewV4().String()
+	statusFile := jobStatusFile(requestUuid)
+
+	// start logging
+	if err := ioutil.WriteFile(statusFile, []byte(asyncOptStatusInProgress), 0644); err != nil {
+		log.Printf("Can't write job status %s. Err: %s", statusFile, err.Error())
+	}
+
+	go func() {
+		result, err := task()
+
+		if result != nil {
+			writeJobResult(requestUuid, result)
+		}
+
+		if err != nil {
+			// log operation failed. Status keeps only code and message
+			// of the error, debug details are logged.
+			log.Printf("Job %s failed. Err: %s", requestUuid, err)
+			code, message := publicError(err)
+			ioutil.WriteFile(statusFile, []byte(code+"\n"+message), 0644)
+		} else {
+			// log operation successfully
+			ioutil.WriteFile(statusFile, []byte(asyncOptStatusCompletedSuccefully), 0644)
+		}
+	}()
+
+	return requestUuid
+}
+
+func writeJobResult(requestUuid string, result interface{}) {
+	resultFile := jobResultFile(requestUuid)
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		log.Printf("Can't encode job result %s. Err: %s", resultFile, err.Error())
+		return
+	}
+
+	if err := ioutil.WriteFile(resultFile, data, 0644); err != nil {
+		log.Printf("Can't write job result %s. Err: %s", resultFile, err.Error())
+	}
+}
+
+func jobStatusFile(requestUuid string) string {
+	return asyncResultDir + requestUuid + ".status"
+}
+
+func jobResultFile(requestUuid string) string {
+	return asyncResultDir + requestUuid + ".result"
+}
@@ -0,0 +1,176 @@
+package znstor
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	listSortName     = "name"
+	listSortSize     = "size"
+	listSortCreation = "creation"
+)
+
+// listParams - common query parameters of list endpoints.
+//   - limit    - max number of returned items
+//   - marker   - return items after the item with specified key
+//   - sort     - sort field: name, size or creation
+//   - order    - asc or desc
+type listParams struct {
+	Limit  int
+	Marker string
+	Sort   string
+	Desc   bool
+	Query  url.Values
+}
+
+// listItem - entry of list response.
+// Key is unique and used as pagination marker.
+type listItem struct {
+	Key      string
+	Name     string
+	Size     uint64
+	Creation uint64
+	Value    interface{}
+}
+
+// parseListParams - parse and check list query parameters.
+// sortFields - sort fields supported by endpoint.
+func parseListParams(r *http.Request, sortFields ...string) (*listParams, error) {
+	query := r.URL.Query()
+	params := &listParams{
+		Marker: query.Get("marker"),
+		Sort:   listSortName,
+		Query:  query,
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value <= 0 {
+			return nil, &Error{
+				Err:    errors.New("limit must be a positive integer"),
+				Debug:  "limit=" + limit,
+				Stderr: "",
+			}
+		}
+		params.Limit = value
+	}
+
+	if field := query.Get("sort"); field != "" {
+		if !checkOption(field, sortFields) {
+			return nil, &Error{
+				Err:    errors.New("unsupported sort field. Supported: " + strings.Join(sortFields, ", ")),
+				Debug:  "sort=" + field,
+				Stderr: "",
+			}
+		}
+		params.Sort = field
+	}
+
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		params.Desc = true
+	default:
+		return nil, &Error{
+			Err:    errors.New("order must be asc or desc"),
+			Debug:  "order=" + query.Get("order"),
+			Stderr: "",
+		}
+	}
+
+	return params, nil
+}
+
+// paginate - sort items, apply marker and limit.
+// Pagination metadata returned in response headers:
+//   - X-Total-Count - number of items matching filters
+//   - X-Next-Marker - marker of the next page, absent on the last page
+func paginate(w http.ResponseWriter, items []listItem, params *listParams) ([]interface{}, error) {
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if params.Desc {
+			a, b = b, a
+		}
+
+		switch params.Sort {
+		case listSortSize:
+			if a.Size != b.Size {
+				return a.Size < b.Size
+			}
+		case listSortCreation:
+			if a.Creation != b.Creation {
+				return a.Creation < b.Creation
+			}
+		}
+
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Key < b.Key
+	})
+
+	start := 0
+	if params.Marker != "" {
+		start = -1
+		for i := range items {
+			if items[i].Key == params.Marker {
+				start = i + 1
+				break
+			}
+		}
+
+		if start < 0 {
+			return nil, &Error{
+				Err:    errors.New("marker not found"),
+				Debug:  "marker=" + params.Marker,
+				Stderr: "",
+			}
+		}
+	}
+
+	end := len(items)
+	if params.Limit > 0 && start+params.Limit < end {
+		end = start + params.Limit
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(items)))
+	if end < len(items) {
+		w.Header().Set("X-Next-Marker", items[end-1].Key)
+	}
+
+	page := make([]interface{}, 0, end-start)
+	for _, item := range items[start:end] {
+		page = append(page, item.Value)
+	}
+	return page, nil
+}
+
+// parseUintFilter - parse optional numeric filter value
+func parseUintFilter(params *listParams, name string) (uint64, bool, error) {
+	value := params.Query.Get(name)
+	if value == "" {
+		return 0, false, nil
+	}
+
+	number, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, false, &Error{
+			Err:    errors.New(name + " must be a positive integer"),
+			Debug:  name + "=" + value,
+			Stderr: "",
+		}
+	}
+	return number, true, nil
+}
+
+// parseUintProp - parse numeric property reported by zfs -p
+// (sizes in bytes, creation in seconds since epoch)
+func parseUintProp(creation string) uint64 {
+	value, _ := strconv.ParseUint(creation, 10, 64)
+	return value
+}
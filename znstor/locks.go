@@ -0,0 +1,107 @@
+package znstor
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// lockManager - per-resource locks keyed by LU GUID, zvol path and group name.
+// COMSTAR configuration has separate lock, used to serialise stmfadm transactions.
+// Resource locks must be acquired before COMSTAR lock.
+type lockManager struct {
+	mu      sync.Mutex
+	locks   map[string]*resourceLock
+	comstar sync.Mutex
+}
+
+type resourceLock struct {
+	sync.Mutex
+	refs int
+}
+
+var locks = newLockManager()
+
+func newLockManager() *lockManager {
+	return &lockManager{locks: make(map[string]*resourceLock)}
+}
+
+func luLockKey(guid string) string {
+	return "lu:" + strings.ToUpper(guid)
+}
+
+func zvolLockKey(zvol string) string {
+	return "zvol:" + zvol
+}
+
+func poolLockKey(pool string) string {
+	return "pool:" + pool
+}
+
+func domainLockKey(domain string) string {
+	return "domain:" + domain
+}
+
+func projectLockKey(project string) string {
+	return "project:" + project
+}
+
+func hostGroupLockKey(hostgroup string) string {
+	return "hg:" + hostgroup
+}
+
+func targetGroupLockKey(targetgroup string) string {
+	return "tg:" + targetgroup
+}
+
+// Lock - acquire locks of specified resources.
+// Keys are locked in sorted order to avoid deadlocks.
+// Returns function, which releases acquired locks.
+func (lm *lockManager) Lock(keys ...string) func() {
+	sorted := make([]string, 0, len(keys))
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		if !seen[key] {
+			seen[key] = true
+			sorted = append(sorted, key)
+		}
+	}
+	sort.Strings(sorted)
+
+	acquired := make([]*resourceLock, 0, len(sorted))
+	for _, key := range sorted {
+		lm.mu.Lock()
+		l, ok := lm.locks[key]
+		if !ok {
+			l = &resourceLock{}
+			lm.locks[key] = l
+		}
+		l.refs++
+		lm.mu.Unlock()
+
+		l.Lock()
+		acquired = append(acquired, l)
+	}
+
+	return func() {
+		for i := len(acquired) - 1; i >= 0; i-- {
+			acquired[i].Unlock()
+		}
+
+		lm.mu.Lock()
+		for i, key := range sorted {
+			acquired[i].refs--
+			if acquired[i].refs == 0 {
+				delete(lm.locks, key)
+			}
+		}
+		lm.mu.Unlock()
+	}
+}
+
+// LockComstar - serialise COMSTAR configuration transactions.
+// Returns function, which releases lock.
+func (lm *lockManager) LockComstar() func() {
+	lm.comstar.Lock()
+	return lm.comstar.Unlock
+}
@@ -0,0 +1,266 @@
+package znstor
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/d-helios/znstord/stmf"
+)
+
+const (
+	// COMSTAR supports LUN numbers 0 - 16383
+	lunMin uint64 = 0
+	lunMax uint64 = 16383
+
+	// host group of views exported to all hosts
+	hostGroupAll = "All"
+)
+
+// range of automatically allocated LUNs
+var lunRange = LunRange{Min: lunMin, Max: lunMax}
+
+// ConfigureLunRange - set range of automatically allocated LUNs.
+// Range not configured (nil) keeps default: all LUNs supported by COMSTAR.
+func ConfigureLunRange(luns *LunRange) error {
+	if luns == nil {
+		return nil
+	}
+
+	if luns.Min > luns.Max || luns.Max > lunMax {
+		return &Error{
+			Err:    fmt.Errorf("Invalid LUN range %d-%d. Range must be within %d-%d", luns.Min, luns.Max, lunMin, lunMax),
+			Debug:  "",
+			Stderr: "",
+		}
+	}
+
+	lunRange = *luns
+	return nil
+}
+
+// hostGroupLunMap - LUNs visible to members of host group.
+// Views exported to all hosts are visible to every host group.
+// Empty host group means "All" and includes views of every host group.
+func hostGroupLunMap(hostGroup string, fresh bool) (*LunMap, error) {
+	lunMap := &LunMap{HostGroup: hostGroup}
+	if hostGroup == "" {
+		lunMap.HostGroup = hostGroupAll
+	}
+
+	entries, err := listVisibleLuns(func(viewHostGroup string) bool {
+		return hostGroup == "" || viewHostGroup == hostGroup || viewHostGroup == hostGroupAll
+	}, fresh)
+	if err != nil {
+		return nil, err
+	}
+	lunMap.Entries = entries
+
+	owners := make(map[uint64]map[string]bool)
+	for _, entry := range entries {
+		if owners[entry.LUN] == nil {
+			owners[entry.LUN] = make(map[string]bool)
+		}
+		owners[entry.LUN][entry.LUName] = true
+	}
+
+	// the same LUN of different logical units is visible to the same hosts
+	for lun, lus := range owners {
+		if len(lus) > 1 {
+			lunMap.Collisions = append(lunMap.Collisions, lun)
+		}
+	}
+	sort.Slice(lunMap.Collisions, func(i, j int) bool {
+		return lunMap.Collisions[i] < lunMap.Collisions[j]
+	})
+
+	return lunMap, nil
+}
+
+// listVisibleLuns - views of all logical units, which host group matches.
+// Logical units and views are taken from inventory, so only views of
+// logical units changed since the last listing are loaded with stmfadm.
+// Entries are sorted by LUN.
+func listVisibleLuns(matchHostGroup func(string) bool, fresh bool) ([]LunMapEntry, error) {
+	if err := inv.ensure(fresh); err != nil {
+		return nil, err
+	}
+
+	entries := []LunMapEntry{}
+
+	for _, lu := range inv.LogicalUnits() {
+		if lu.ViewEntryCount == 0 {
+			continue
+		}
+
+		views, err := inv.Views(lu, false)
+		if err != nil {
+			// cached view entry count is stale, views were removed
+			if errors.Is(err, stmf.ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+
+		for _, view := range views {
+			if !matchHostGroup(view.HostGroup) {
+				continue
+			}
+
+			entries = append(entries, LunMapEntry{
+				LUN:         view.LUN,
+				LUName:      lu.LUName,
+				Alias:       lu.Alias,
+				Zvol:        lu.GetZvol(),
+				Project:     projectOfZvol(lu.GetZvol()),
+				HostGroup:   view.HostGroup,
+				TargetGroup: view.TargetGroup,
+				ViewEntry:   view.ViewEntry,
+			})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].LUN == entries[j].LUN {
+			return entries[i].LUName < entries[j].LUName
+		}
+		return entries[i].LUN < entries[j].LUN
+	})
+
+	return entries, nil
+}
+
+// initiatorVisibility - host group memberships of initiator (IQN or WWN)
+// and logical units visible to it, including views exported to all hosts.
+func initiatorVisibility(initiator string, fresh bool) (*Visibility, error) {
+	hostGroups, err := stmf.ListHostGroup("")
+	if err != nil {
+		return nil, err
+	}
+
+	visibility := &Visibility{Initiator: initiator, HostGroups: []string{}}
+	memberOf := make(map[string]bool)
+
+	for _, hostGroup := range hostGroups {
+		for _, member := range hostGroup.Members {
+			if strings.EqualFold(member, initiator) {
+				visibility.HostGroups = append(visibility.HostGroups, hostGroup.HostGroup)
+				memberOf[hostGroup.HostGroup] = true
+				break
+			}
+		}
+	}
+
+	visibility.Volumes, err = listVisibleLuns(func(viewHostGroup string) bool {
+		return viewHostGroup == hostGroupAll || memberOf[viewHostGroup]
+	}, fresh)
+	if err != nil {
+		return nil, err
+	}
+
+	return visibility, nil
+}
+
+// hostGroupVisibility - members of host group and logical units visible to them,
+// including views exported to all hosts.
+func hostGroupVisibility(hostGroupName string, fresh bool) (*Visibility, error) {
+	hostGroup, err := stmf.GetHostGroup(hostGroupName)
+	if err != nil {
+		return nil, err
+	}
+
+	visibility := &Visibility{
+		HostGroups: []string{hostGroup.HostGroup},
+		Members:    hostGroup.Members,
+	}
+
+	visibility.Volumes, err = listVisibleLuns(func(viewHostGroup string) bool {
+		return viewHostGroup == hostGroupAll || viewHostGroup == hostGroup.HostGroup
+	}, fresh)
+	if err != nil {
+		return nil, err
+	}
+
+	return visibility, nil
+}
+
+// selectLun - check requested LUN against LUNs used in host group or pick
+// the lowest LUN within range, which isn't used.
+func selectLun(lunMap *LunMap, requested *int64, luns LunRange) (int64, error) {
+	used := make(map[uint64]LunMapEntry)
+	for _, entry := range lunMap.Entries {
+		used[entry.LUN] = entry
+	}
+
+	if requested != nil {
+		if *requested < int64(lunMin) || *requested > int64(lunMax) {
+			return 0, &Error{
+				Err:    fmt.Errorf("Invalid LUN %d. LUN must be within %d-%d", *requested, lunMin, lunMax),
+				Debug:  "",
+				Stderr: "",
+			}
+		}
+
+		if entry, ok := used[uint64(*requested)]; ok {
+			return 0, &Error{
+				Err: fmt.Errorf("LUN %d is already used by %s (%s) in host group %s",
+					*requested, entry.LUName, entry.Alias, entry.HostGroup),
+				Debug:  fmt.Sprintf("host group: %s, entry: %+v", lunMap.HostGroup, entry),
+				Stderr: "",
+			}
+		}
+		return *requested, nil
+	}
+
+	for lun := luns.Min; lun <= luns.Max; lun++ {
+		if _, ok := used[lun]; !ok {
+			return int64(lun), nil
+		}
+	}
+
+	return 0, &Error{
+		Err:    fmt.Errorf("No free LUN in range %d-%d for host group %s", luns.Min, luns.Max, lunMap.HostGroup),
+		Debug:  "",
+		Stderr: "",
+	}
+}
+
+// addView - export logical unit with allocated LUN. LUN map of the host
+// group is built from inventory without COMSTAR lock. Under the lock it is
+// rebuilt only if inventory was modified meanwhile (ex: view was added by
+// concurrent export to another host group).
+// Caller must hold logical unit and host group locks, but not COMSTAR lock.
+func addView(lu *stmf.LogicalUnit, export ExportRequest) (*stmf.View, error) {
+	generation := inv.Generation()
+
+	lunMap, err := hostGroupLunMap(export.Hostgroup, false)
+	if err != nil {
+		return nil, err
+	}
+
+	unlockComstar := locks.LockComstar()
+	defer unlockComstar()
+
+	if inv.Generation() != generation {
+		lunMap, err = hostGroupLunMap(export.Hostgroup, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	lun, err := selectLun(lunMap, export.Lun, lunRange)
+	if err != nil {
+		return nil, err
+	}
+
+	view, err := lu.AddView(export.Hostgroup, export.Targetgroup, lun)
+	if err != nil {
+		return nil, err
+	}
+
+	// allocated LUN is visible to concurrent allocations once COMSTAR lock is released
+	inv.UpdateLu(lu)
+
+	return view, nil
+}
@@ -0,0 +1,177 @@
+package znstor
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/d-helios/znstord/stmf"
+)
+
+func lunMapOf(luns ...uint64) *LunMap {
+	lunMap := &LunMap{HostGroup: "hg1"}
+	for _, lun := range luns {
+		lunMap.Entries = append(lunMap.Entries, LunMapEntry{
+			LUN:       lun,
+			LUName:    "600144F0000000000000000000000001",
+			HostGroup: "hg1",
+		})
+	}
+	return lunMap
+}
+
+func lunPtr(lun int64) *int64 {
+	return &lun
+}
+
+func TestSelectLunFree(t *testing.T) {
+	tests := []struct {
+		used     []uint64
+		luns     LunRange
+		expected int64
+	}{
+		{nil, LunRange{Min: 0, Max: lunMax}, 0},
+		{[]uint64{0, 1, 2}, LunRange{Min: 0, Max: lunMax}, 3},
+		{[]uint64{0, 2}, LunRange{Min: 0, Max: lunMax}, 1},
+		{[]uint64{0, 1}, LunRange{Min: 10, Max: 20}, 10},
+		{[]uint64{10, 11}, LunRange{Min: 10, Max: 20}, 12},
+		{nil, LunRange{Min: 0, Max: 0}, 0},
+		{[]uint64{lunMax - 1}, LunRange{Min: lunMax - 1, Max: lunMax}, int64(lunMax)},
+	}
+
+	for _, test := range tests {
+		lun, err := selectLun(lunMapOf(test.used...), nil, test.luns)
+		if err != nil {
+			t.Errorf("used %v, range %+v: %v", test.used, test.luns, err)
+			continue
+		}
+		if lun != test.expected {
+			t.Errorf("used %v, range %+v: LUN %d, expected %d", test.used, test.luns, lun, test.expected)
+		}
+	}
+}
+
+func TestSelectLunExhausted(t *testing.T) {
+	tests := []struct {
+		used []uint64
+		luns LunRange
+	}{
+		{[]uint64{0}, LunRange{Min: 0, Max: 0}},
+		{[]uint64{10, 11, 12}, LunRange{Min: 10, Max: 12}},
+	}
+
+	for _, test := range tests {
+		if lun, err := selectLun(lunMapOf(test.used...), nil, test.luns); err == nil {
+			t.Errorf("used %v, range %+v: LUN %d, expected error", test.used, test.luns, lun)
+		}
+	}
+}
+
+func TestSelectLunRequested(t *testing.T) {
+	lunMap := lunMapOf(0, 5)
+	luns := LunRange{Min: 10, Max: 20}
+
+	// requested LUN isn't limited by configured range
+	for _, requested := range []int64{1, 4, 6, int64(lunMax)} {
+		lun, err := selectLun(lunMap, lunPtr(requested), luns)
+		if err != nil {
+			t.Errorf("requested %d: %v", requested, err)
+			continue
+		}
+		if lun != requested {
+			t.Errorf("requested %d: LUN %d", requested, lun)
+		}
+	}
+
+	for _, requested := range []int64{0, 5, -1, int64(lunMax) + 1} {
+		if lun, err := selectLun(lunMap, lunPtr(requested), luns); err == nil {
+			t.Errorf("requested %d: LUN %d, expected error", requested, lun)
+		}
+	}
+}
+
+func TestConfigureLunRange(t *testing.T) {
+	defer func(saved LunRange) { lunRange = saved }(lunRange)
+
+	if err := ConfigureLunRange(nil); err != nil {
+		t.Errorf("nil range: %v", err)
+	}
+	if lunRange != (LunRange{Min: lunMin, Max: lunMax}) {
+		t.Errorf("nil range changed default: %+v", lunRange)
+	}
+
+	if err := ConfigureLunRange(&LunRange{Min: 0, Max: 0}); err != nil {
+		t.Errorf("range 0-0: %v", err)
+	}
+	if lunRange != (LunRange{Min: 0, Max: 0}) {
+		t.Errorf("range 0-0 not configured: %+v", lunRange)
+	}
+
+	for _, luns := range []LunRange{{Min: 5, Max: 4}, {Min: 0, Max: lunMax + 1}} {
+		if err := ConfigureLunRange(&luns); err == nil {
+			t.Errorf("range %+v: expected error", luns)
+		}
+	}
+}
+
+// withCachedViews - run test with valid inventory of logical units and views
+func withCachedViews(views map[string][]stmf.View) func() {
+	saved := inv
+	inv = newInventory()
+	inv.valid = true
+
+	for guid, luViews := range views {
+		inv.storeLu(&stmf.LogicalUnit{
+			LUName:         guid,
+			Alias:          "vol-" + guid[len(guid)-1:],
+			DataFile:       "/dev/zvol/rdsk/tank/domain/project/vol-" + guid[len(guid)-1:],
+			ViewEntryCount: uint64(len(luViews)),
+		})
+		if len(luViews) > 0 {
+			inv.views[guid] = luViews
+		}
+	}
+
+	return func() { inv = saved }
+}
+
+func TestHostGroupLunMapCached(t *testing.T) {
+	defer withCachedViews(map[string][]stmf.View{
+		"600144F0000000000000000000000001": {{ViewEntry: 0, HostGroup: "hg1", TargetGroup: "All", LUN: 0}},
+		"600144F0000000000000000000000002": {{ViewEntry: 0, HostGroup: "All", TargetGroup: "All", LUN: 1}},
+		"600144F0000000000000000000000003": {{ViewEntry: 0, HostGroup: "hg2", TargetGroup: "All", LUN: 0}},
+		"600144F0000000000000000000000004": nil,
+	})()
+
+	// LUN map is built without stmfadm
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", "")
+	defer os.Setenv("PATH", path)
+
+	tests := []struct {
+		hostGroup  string
+		luns       []uint64
+		collisions []uint64
+	}{
+		{"hg1", []uint64{0, 1}, nil},
+		{"hg2", []uint64{0, 1}, nil},
+		{"hg3", []uint64{1}, nil},
+		{"", []uint64{0, 0, 1}, []uint64{0}},
+	}
+
+	for _, test := range tests {
+		lunMap, err := hostGroupLunMap(test.hostGroup, false)
+		if err != nil {
+			t.Errorf("%q: %v", test.hostGroup, err)
+			continue
+		}
+
+		var luns []uint64
+		for _, entry := range lunMap.Entries {
+			luns = append(luns, entry.LUN)
+		}
+		if !reflect.DeepEqual(luns, test.luns) || !reflect.DeepEqual(lunMap.Collisions, test.collisions) {
+			t.Errorf("%q: LUNs %v, collisions %v, expected %v, %v", test.hostGroup, luns, lunMap.Collisions, test.luns, test.collisions)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package znstor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/d-helios/znstord/zfs"
+	"github.com/gorilla/mux"
+)
+
+// zfs user property name: namespace:name of lowercase letters, digits and ':', '+', '.', '_', '-'
+var userPropRegexp = regexp.MustCompile(`^[a-z0-9_.+-]+:[a-z0-9_.:+-]+$`)
+
+// tagFilter - filter of list endpoints by user property.
+// Empty value matches any value set on the dataset.
+type tagFilter struct {
+	Name  string
+	Value string
+}
+
+// checkUserPropertyName - user property settable through API.
+// custom: namespace is used by znstor itself (alias, flags, limits, defaults).
+func checkUserPropertyName(name string) string {
+	switch {
+	case len(name) > userPropNameMaxLength:
+		return fmt.Sprintf("must not be longer than %d characters", userPropNameMaxLength)
+	case !userPropRegexp.MatchString(name):
+		return "must be namespace:name of lowercase letters, digits, ':', '+', '.', '_' and '-'"
+	case strings.HasPrefix(name, internalPropNamespace):
+		return "namespace " + internalPropNamespace + " is reserved"
+	}
+	return ""
+}
+
+// checkUserPropertyValue - tabs and newlines would break parsing of zfs output
+func checkUserPropertyValue(value string) string {
+	if len(value) > userPropValueMaxLength {
+		return fmt.Sprintf("must not be longer than %d characters", userPropValueMaxLength)
+	}
+	for _, c := range value {
+		if c < ' ' || c == 0x7f {
+			return "must not contain control characters"
+		}
+	}
+	return ""
+}
+
+// Validate - check user property names and values
+func (req UserPropertiesRequest) Validate() error {
+	e := &ValidationError{}
+
+	if len(req) == 0 {
+		e.check("properties", "must not be empty")
+	}
+
+	for _, name := range req.names() {
+		e.check(name, checkUserPropertyName(name))
+		if req[name] != nil {
+			e.check(name, checkUserPropertyValue(*req[name]))
+		}
+	}
+	return e.err()
+}
+
+func (req UserPropertiesRequest) names() []string {
+	names := make([]string, 0, len(req))
+	for name := range req {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// publicProperties - dataset properties without znstor internal ones
+func publicProperties(props zfs.Properties) zfs.Properties {
+	public := make(zfs.Properties)
+	for name, prop := range props {
+		if !strings.HasPrefix(name, internalPropNamespace) {
+			public[name] = prop
+		}
+	}
+	return public
+}
+
+// userProperties - user (namespace:name) properties of the dataset
+func userProperties(props zfs.Properties) zfs.Properties {
+	user := make(zfs.Properties)
+	for name, prop := range publicProperties(props) {
+		if strings.Contains(name, ":") {
+			user[name] = prop
+		}
+	}
+	return user
+}
+
+// datasetProperties - public properties of the dataset together with sources
+func datasetProperties(dataset string) (zfs.Properties, error) {
+	ds := &zfs.Dataset{Dataset: dataset}
+	if err := ds.RefreshProps(); err != nil {
+		return nil, err
+	}
+	return publicProperties(ds.Properties), nil
+}
+
+// setUserProperties - set user properties of the dataset. Properties with
+// null value are inherited. On failure already applied properties are
+// restored, so the request is applied completely or not at all.
+func setUserProperties(dataset string, req UserPropertiesRequest) error {
+	saved, err := datasetProperties(dataset)
+	if err != nil {
+		return err
+	}
+
+	ds := &zfs.Dataset{Dataset: dataset}
+	var applied []string
+
+	for _, name := range req.names() {
+		if req[name] == nil {
+			err = ds.InheritProp(name)
+		} else {
+			err = ds.SetProp(name, *req[name])
+		}
+
+		if err != nil {
+			for _, name := range applied {
+				if err := restoreZfsProp(ds, name, saved[name]); err != nil {
+					log.Printf("Can't restore %s of %s. Err: %s", name, dataset, err.Error())
+				}
+			}
+			return err
+		}
+		applied = append(applied, name)
+	}
+	return nil
+}
+
+// propertiesDataset - dataset addressed by properties route: project,
+// filesystem, volume or snapshot of filesystem or volume.
+func propertiesDataset(r *http.Request) (string, error) {
+	vars := mux.Vars(r)
+	basepath := vars["pool"] + "/" + vars["domain"] + "/" + vars["project"]
+	dataset := basepath
+
+	if volumeName, ok := vars["volume"]; ok {
+		lu, err := inv.GetLu(volumeName, isFresh(r))
+		if err != nil {
+			return "", err
+		}
+
+		if !IsVolumeBelongsToProject(basepath, *lu) {
+			return "", &Error{
+				Err:    errors.New("Volume not found in specified project"),
+				Debug:  fmt.Sprintf("LU: %s, project: %s", lu.LUName, basepath),
+				Stderr: "",
+				Kind:   codeNotFound,
+			}
+		}
+		dataset = lu.GetZvol()
+	}
+
+	if filesystem, ok := vars["filesystem"]; ok {
+		dataset = basepath + "/" + filesystem
+	}
+
+	if snapshot, ok := vars["snapshot"]; ok {
+		dataset += "@" + snapshot
+	}
+
+	return dataset, nil
+}
+
+// Get user properties of project, filesystem, volume or snapshot
+func HandlerGetUserProperties(w http.ResponseWriter, r *http.Request) {
+	dataset, err := propertiesDataset(r)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	props, err := datasetProperties(dataset)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(userProperties(props))
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+	}
+}
+
+// Set user properties of project, filesystem, volume or snapshot.
+// Returns all user properties of the dataset.
+func HandlerSetUserProperties(w http.ResponseWriter, r *http.Request) {
+	dataset, err := propertiesDataset(r)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	var reqJson UserPropertiesRequest
+	err = decodeRequest(r, &reqJson, requestPayloadMaxSize)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	if err := setUserProperties(dataset, reqJson); err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	props, err := datasetProperties(dataset)
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(userProperties(props))
+	if err != nil {
+		sendError(w, traceFunctionName(), err)
+	}
+}
+
+// parseTagFilters - parse tag query parameters of list endpoints:
+// tag=namespace:name or tag=namespace:name=value. All filters must match.
+func parseTagFilters(params *listParams) ([]tagFilter, error) {
+	var filters []tagFilter
+
+	for _, tag := range params.Query["tag"] {
+		filter := tagFilter{Name: tag}
+		if i := strings.Index(tag, "="); i >= 0 {
+			filter = tagFilter{Name: tag[:i], Value: tag[i+1:]}
+		}
+
+		if msg := checkUserPropertyName(filter.Name); msg != "" {
+			return nil, &Error{
+				Err:    fmt.Errorf("tag %s %s", filter.Name, msg),
+				Debug:  "tag=" + tag,
+				Stderr: "",
+				Kind:   codeInvalidArgument,
+			}
+		}
+		filters = append(filters, filter)
+	}
+
+	return filters, nil
+}
+
+// tagNames - user properties requested by tag filters
+func tagNames(filters []tagFilter) []string {
+	var names []string
+	for _, filter := range filters {
+		if !checkOption(filter.Name, names) {
+			names = append(names, filter.Name)
+		}
+	}
+	return names
+}
+
+// taggedDatasets - names of datasets under basepath matching all tag filters
+func taggedDatasets(datasetType, basepath string, depth uint64, filters []tagFilter) (map[string]bool, error) {
+	datasets, err := zfs.ListDatasetProps(datasetType, basepath, true, depth, tagNames(filters)...)
+	if err != nil {
+		return nil, err
+	}
+
+	tagged := make(map[string]bool)
+	for _, dataset := range datasets {
+		if matchTags(dataset, filters) {
+			tagged[dataset["name"]] = true
+		}
+	}
+	return tagged, nil
+}
+
+// matchTags - zfs reports unset user properties as "-"
+func matchTags(dataset map[string]string, filters []tagFilter) bool {
+	for _, filter := range filters {
+		value := dataset[filter.Name]
+		if value == "" || value == "-" {
+			return false
+		}
+		if filter.Value != "" && value != filter.Value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,211 @@
+package znstor
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fake zfs keeps properties of the single dataset in the state directory
+// as "name<tab>value<tab>source" lines. Setting value "fail" fails.
+const fakeZfsPropsScript = `#!/bin/sh
+state=$(dirname "$0")
+tab=$(printf '\t')
+eval last=\${$#}
+remove() {
+	grep -v "^$1$tab" "$state/props" > "$state/props.new"
+	mv "$state/props.new" "$state/props"
+}
+case "$1" in
+get) printf 'type\tvolume\t-\n'; cat "$state/props" ;;
+set)
+	case "$2" in
+	*=fail) echo "cannot set property for '$last': permission denied" >&2; exit 1 ;;
+	esac
+	remove "${2%%=*}"
+	printf '%s\t%s\tlocal\n' "${2%%=*}" "${2#*=}" >> "$state/props" ;;
+inherit) remove "$2" ;;
+esac
+`
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestCheckUserPropertyName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"org.example:owner", true},
+		{"com.sun:auto-snapshot", true},
+		{"a:b:c", true},
+		{"org.example:" + strings.Repeat("a", userPropNameMaxLength-len("org.example:")), true},
+		{"org.example:" + strings.Repeat("a", userPropNameMaxLength-len("org.example:")+1), false},
+		{"custom:alias", false},
+		{"custom:owner", false},
+		{"owner", false},
+		{":owner", false},
+		{"org.example:", false},
+		{"Org.Example:owner", false},
+		{"org.example:my owner", false},
+		{"org.example:owner=1", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		if msg := checkUserPropertyName(test.name); (msg == "") != test.valid {
+			t.Errorf("%q: valid %v, message %q", test.name, test.valid, msg)
+		}
+	}
+}
+
+func TestCheckUserPropertyValue(t *testing.T) {
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{"", true},
+		{"John Smith", true},
+		{"key=value; other", true},
+		{"значение", true},
+		{strings.Repeat("a", userPropValueMaxLength), true},
+		{strings.Repeat("a", userPropValueMaxLength+1), false},
+		{"a\tb", false},
+		{"a\nb", false},
+		{"a\x00b", false},
+		{"a\x7fb", false},
+	}
+
+	for _, test := range tests {
+		if msg := checkUserPropertyValue(test.value); (msg == "") != test.valid {
+			t.Errorf("%.20q: valid %v, message %q", test.value, test.valid, msg)
+		}
+	}
+}
+
+func TestUserPropertiesRequestValidate(t *testing.T) {
+	tests := []struct {
+		req    UserPropertiesRequest
+		fields []string
+	}{
+		{UserPropertiesRequest{"org.example:owner": strPtr("ops"), "org.example:env": nil}, nil},
+		{UserPropertiesRequest{}, []string{"properties"}},
+		{UserPropertiesRequest{"custom:sflag": nil}, []string{"custom:sflag"}},
+		{UserPropertiesRequest{"org.example:owner": strPtr("a\nb"), "owner": strPtr("ops")},
+			[]string{"org.example:owner", "owner"}},
+	}
+
+	for i, test := range tests {
+		fields := invalidFields(t, test.req.Validate())
+		if !reflect.DeepEqual(fields, test.fields) {
+			t.Errorf("request %d: invalid fields %q, expected %q", i, fields, test.fields)
+		}
+	}
+}
+
+func TestParseTagFilters(t *testing.T) {
+	tests := []struct {
+		tags    []string
+		filters []tagFilter
+	}{
+		{nil, nil},
+		{[]string{"org.example:owner"}, []tagFilter{{Name: "org.example:owner"}}},
+		{[]string{"org.example:owner=ops"}, []tagFilter{{Name: "org.example:owner", Value: "ops"}}},
+		{[]string{"org.example:url=a=b"}, []tagFilter{{Name: "org.example:url", Value: "a=b"}}},
+		{[]string{"org.example:owner=", "org.example:env=prod"},
+			[]tagFilter{{Name: "org.example:owner"}, {Name: "org.example:env", Value: "prod"}}},
+	}
+
+	for _, test := range tests {
+		filters, err := parseTagFilters(&listParams{Query: url.Values{"tag": test.tags}})
+		if err != nil {
+			t.Errorf("%q: %v", test.tags, err)
+			continue
+		}
+		if !reflect.DeepEqual(filters, test.filters) {
+			t.Errorf("%q: filters %+v, expected %+v", test.tags, filters, test.filters)
+		}
+	}
+
+	for _, tag := range []string{"owner", "custom:sflag", "custom:alias=vol1", "=ops", "Org.Example:owner"} {
+		if _, err := parseTagFilters(&listParams{Query: url.Values{"tag": {tag}}}); err == nil {
+			t.Errorf("%q: expected error", tag)
+		}
+	}
+}
+
+func TestMatchTags(t *testing.T) {
+	dataset := map[string]string{
+		"name":              "tank/domain/project/vol1",
+		"org.example:owner": "ops",
+		"org.example:env":   "-",
+		"org.example:zone":  "",
+	}
+
+	tests := []struct {
+		filters []tagFilter
+		match   bool
+	}{
+		{nil, true},
+		{[]tagFilter{{Name: "org.example:owner"}}, true},
+		{[]tagFilter{{Name: "org.example:owner", Value: "ops"}}, true},
+		{[]tagFilter{{Name: "org.example:owner", Value: "dev"}}, false},
+		{[]tagFilter{{Name: "org.example:env"}}, false},
+		{[]tagFilter{{Name: "org.example:env", Value: "-"}}, false},
+		{[]tagFilter{{Name: "org.example:zone"}}, false},
+		{[]tagFilter{{Name: "org.example:missing"}}, false},
+		{[]tagFilter{{Name: "org.example:owner"}, {Name: "org.example:env"}}, false},
+	}
+
+	for _, test := range tests {
+		if match := matchTags(dataset, test.filters); match != test.match {
+			t.Errorf("%+v: match %v, expected %v", test.filters, match, test.match)
+		}
+	}
+}
+
+func TestSetUserPropertiesRollback(t *testing.T) {
+	dataset := "tank/domain/project/vol1"
+	_, restore := fakeCommandsDir(t, map[string]string{
+		"zfs":   fakeZfsPropsScript,
+		"props": "org.example:env\tprod\tlocal\norg.example:owner\tops\tlocal\n",
+	})
+	defer restore()
+
+	before, err := datasetProperties(dataset)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// properties are applied in order of names, the last one fails
+	err = setUserProperties(dataset, UserPropertiesRequest{
+		"org.example:env":   nil,
+		"org.example:new":   strPtr("value"),
+		"org.example:owner": strPtr("dev"),
+		"org.example:zone":  strPtr("fail"),
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	after, err := datasetProperties(dataset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(userProperties(after), userProperties(before)) {
+		t.Errorf("properties %+v, expected %+v", userProperties(after), userProperties(before))
+	}
+
+	if err := setUserProperties(dataset, UserPropertiesRequest{"org.example:owner": strPtr("dev")}); err != nil {
+		t.Fatal(err)
+	}
+	after, err = datasetProperties(dataset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner := after["org.example:owner"].Value; owner != "dev" {
+		t.Errorf("owner %q, expected %q", owner, "dev")
+	}
+}
@@ -11,7 +11,8 @@ import (
 const (
 	API_BASE_PATH = "/api/v1/storage"
 	// Domains && Pools && Projects
-	DOMAIN_BASE_PATH  = API_BASE_PATH + "/domains/{domain}"
+	DOMAIN_LIST_PATH  = API_BASE_PATH + "/domains"
+	DOMAIN_BASE_PATH  = DOMAIN_LIST_PATH + "/{domain}"
 	POOL_BASE_PATH    = DOMAIN_BASE_PATH + "/pools"
 	PROJECT_BASE_PATH = POOL_BASE_PATH + "/{pool}/projects"
 
@@ -23,8 +24,15 @@ const (
 	VOLUME_BASE_PATH          = PROJECT_BASE_PATH + "/{project}/volumes"
 	VOLUME_SNAPSHOT_BASE_PATH = VOLUME_BASE_PATH + "/{volume}/snapshots"
 
+	// ZFS pools inventory
+	ZPOOL_BASE_PATH = API_BASE_PATH + "/pools"
+
+	// Unmanaged zvols and logical units
+	UNMANAGED_BASE_PATH = POOL_BASE_PATH + "/{pool}/unmanaged"
+
 	// Hosts
-	HOST_BASE_PATH = API_BASE_PATH + "/hosts"
+	HOST_BASE_PATH      = API_BASE_PATH + "/hosts"
+	INITIATOR_BASE_PATH = API_BASE_PATH + "/initiators"
 
 	// Targets
 	TARGET_BASE_PATH = API_BASE_PATH + "/targets"
@@ -39,15 +47,34 @@ type Route struct {
 
 type Routes []Route
 
-func NewRouter(logOutput io.Writer, login, password string) *mux.Router {
+func NewRouter(logOutput io.Writer, auth, admin AuthData) *mux.Router {
 
 	router := mux.NewRouter().StrictSlash(true)
+	loadRoutes(router, routes, logOutput, auth)
+
+	// maintenance api is disabled, until admin credentials are configured
+	if admin.UserName == "" || admin.UserPassword == "" {
+		log.Println("Admin credentials are not configured. Pool maintenance routes are disabled")
+	} else {
+		loadRoutes(router, adminRoutes, logOutput, admin)
+	}
+
+	return router
+}
+
+func loadRoutes(router *mux.Router, routes Routes, logOutput io.Writer, auth AuthData) {
 	for _, route := range routes {
 		log.Println("LOAD_ROUTE: ", route)
 		var handler http.Handler
 
-		handler = route.HandlerFunc
-		handler = Wrapper(handler, route.Name, logOutput, login, password)
+		handler = ValidateVars(route.HandlerFunc)
+
+		// creating requests could be retried with Idempotency-Key
+		if route.Method == "POST" {
+			handler = Idempotent(handler)
+		}
+
+		handler = Wrapper(handler, route.Name, logOutput, auth.UserName, auth.UserPassword)
 
 		router.
 			Methods(route.Method).
@@ -55,12 +82,100 @@ func NewRouter(logOutput io.Writer, login, password string) *mux.Router {
 			Name(route.Name).
 			Handler(handler)
 	}
+}
 
-	return router
+// Pool maintenance routes. Require admin credentials
+var adminRoutes = Routes{
+	Route{
+		"PoolScrubStatus",
+		"GET",
+		ZPOOL_BASE_PATH + "/{pool}/scrub",
+		HandlerGetPoolScrub,
+	},
+	Route{
+		"StartPoolScrub",
+		"PUT",
+		ZPOOL_BASE_PATH + "/{pool}/scrub",
+		HandlerStartPoolScrub,
+	},
+	Route{
+		"PausePoolScrub",
+		"PUT",
+		ZPOOL_BASE_PATH + "/{pool}/scrub/pause",
+		HandlerPausePoolScrub,
+	},
+	Route{
+		"CancelPoolScrub",
+		"PUT",
+		ZPOOL_BASE_PATH + "/{pool}/scrub/cancel",
+		HandlerCancelPoolScrub,
+	},
+	Route{
+		"ClearPool",
+		"PUT",
+		ZPOOL_BASE_PATH + "/{pool}/clear",
+		HandlerClearPool,
+	},
+	Route{
+		"TrimPool",
+		"PUT",
+		ZPOOL_BASE_PATH + "/{pool}/trim",
+		HandlerTrimPool,
+	},
+	Route{
+		"PoolJobStatus",
+		"GET",
+		ZPOOL_BASE_PATH + "/job/{uuid}",
+		HandlerGetJobStatus,
+	},
 }
 
 var routes = Routes{
 
+	/*
+		ZFS Pool Routes
+	*/
+	Route{
+		"ListPools",
+		"GET",
+		ZPOOL_BASE_PATH,
+		HandlerGetPoolList,
+	},
+	Route{
+		"GetPool",
+		"GET",
+		ZPOOL_BASE_PATH + "/{pool}",
+		HandlerGetPool,
+	},
+
+	/*
+		Domain Routes
+	*/
+	Route{
+		"ListDomains",
+		"GET",
+		DOMAIN_LIST_PATH,
+		HandlerGetDomainList,
+	},
+	Route{
+		"GetDomain",
+		"GET",
+		DOMAIN_BASE_PATH,
+		HandlerGetDomain,
+	},
+	Route{
+		"CreateDomain",
+		"POST",
+		POOL_BASE_PATH + "/{pool}",
+		HandlerCreateDomain,
+	},
+	Route{
+		"DestroyDomain",
+		"DELETE",
+		POOL_BASE_PATH + "/{pool}",
+		HandlerDestroyDomain,
+	},
+
 	/*
 		Project Routes
 	*/
@@ -83,6 +198,24 @@ var routes = Routes{
 		PROJECT_BASE_PATH + "/{project}/exists",
 		HandlerProjectExists,
 	},
+	Route{
+		"GetProjectCapacity",
+		"GET",
+		PROJECT_BASE_PATH + "/{project}/capacity",
+		HandlerGetProjectCapacity,
+	},
+	Route{
+		"GetProjectDefaults",
+		"GET",
+		PROJECT_BASE_PATH + "/{project}/defaults",
+		HandlerGetProjectDefaults,
+	},
+	Route{
+		"SetProjectDefaults",
+		"PUT",
+		PROJECT_BASE_PATH + "/{project}/defaults",
+		HandlerSetProjectDefaults,
+	},
 	Route{
 		"CreateProject",
 		"POST",
@@ -107,6 +240,46 @@ var routes = Routes{
 		PROJECT_BASE_PATH + "/{project}/force",
 		HandlerForceDestroyProject,
 	},
+	Route{
+		"GetProjectProperties",
+		"GET",
+		PROJECT_BASE_PATH + "/{project}/properties",
+		HandlerGetUserProperties,
+	},
+	Route{
+		"SetProjectProperties",
+		"PUT",
+		PROJECT_BASE_PATH + "/{project}/properties",
+		HandlerSetUserProperties,
+	},
+
+	/*
+		Filesystem Routes
+	*/
+	Route{
+		"GetFilesystemProperties",
+		"GET",
+		FILESYSTEM_BASE_PATH + "/{filesystem}/properties",
+		HandlerGetUserProperties,
+	},
+	Route{
+		"SetFilesystemProperties",
+		"PUT",
+		FILESYSTEM_BASE_PATH + "/{filesystem}/properties",
+		HandlerSetUserProperties,
+	},
+	Route{
+		"GetFilesystemSnapshotProperties",
+		"GET",
+		FILESYSTEM_SNAPSHOT_BASE_PATH + "/{snapshot}/properties",
+		HandlerGetUserProperties,
+	},
+	Route{
+		"SetFilesystemSnapshotProperties",
+		"PUT",
+		FILESYSTEM_SNAPSHOT_BASE_PATH + "/{snapshot}/properties",
+		HandlerSetUserProperties,
+	},
 
 	/*
 		Volume Routes
@@ -129,6 +302,36 @@ var routes = Routes{
 		VOLUME_BASE_PATH,
 		HandlerCreateVolume,
 	},
+	Route{
+		"AdoptVolume",
+		"POST",
+		VOLUME_BASE_PATH + "/adopt",
+		HandlerAdoptVolume,
+	},
+	Route{
+		"ReleaseVolume",
+		"PUT",
+		VOLUME_BASE_PATH + "/{volume}/release",
+		HandlerReleaseVolume,
+	},
+	Route{
+		"ModifyVolume",
+		"PATCH",
+		VOLUME_BASE_PATH + "/{volume}",
+		HandlerModifyVolume,
+	},
+	Route{
+		"OfflineVolume",
+		"PUT",
+		VOLUME_BASE_PATH + "/{volume}/offline",
+		HandlerOfflineVolume,
+	},
+	Route{
+		"OnlineVolume",
+		"PUT",
+		VOLUME_BASE_PATH + "/{volume}/online",
+		HandlerOnlineVolume,
+	},
 	Route{
 		"DestroyVolume",
 		"DELETE",
@@ -141,12 +344,48 @@ var routes = Routes{
 		VOLUME_BASE_PATH + "/{volume}/resize",
 		HandlerResizeVolume,
 	},
+	Route{
+		"GrowVolume",
+		"PUT",
+		VOLUME_BASE_PATH + "/{volume}/grow",
+		HandlerGrowVolume,
+	},
+	Route{
+		"ShrinkVolume",
+		"PUT",
+		VOLUME_BASE_PATH + "/{volume}/shrink",
+		HandlerShrinkVolume,
+	},
+	Route{
+		"RenameVolume",
+		"PUT",
+		VOLUME_BASE_PATH + "/{volume}/rename",
+		HandlerRenameVolume,
+	},
+	Route{
+		"MoveVolume",
+		"PUT",
+		VOLUME_BASE_PATH + "/{volume}/move",
+		HandlerMoveVolume,
+	},
 	Route{
 		"SetVolumeCompression",
 		"PUT",
 		VOLUME_BASE_PATH + "/{volume}/compression/{compression}",
 		HandlerSetVolumeCompression,
 	},
+	Route{
+		"GetVolumeProperties",
+		"GET",
+		VOLUME_BASE_PATH + "/{volume}/properties",
+		HandlerGetUserProperties,
+	},
+	Route{
+		"SetVolumeProperties",
+		"PUT",
+		VOLUME_BASE_PATH + "/{volume}/properties",
+		HandlerSetUserProperties,
+	},
 	Route{
 		"CreateVolumeSnapshot",
 		"POST",
@@ -183,6 +422,18 @@ var routes = Routes{
 		VOLUME_SNAPSHOT_BASE_PATH + "/{snapshot}/clone",
 		HandlerCloneVolumeFromSnapshot,
 	},
+	Route{
+		"GetVolumeSnapshotProperties",
+		"GET",
+		VOLUME_SNAPSHOT_BASE_PATH + "/{snapshot}/properties",
+		HandlerGetUserProperties,
+	},
+	Route{
+		"SetVolumeSnapshotProperties",
+		"PUT",
+		VOLUME_SNAPSHOT_BASE_PATH + "/{snapshot}/properties",
+		HandlerSetUserProperties,
+	},
 	Route{
 		"ExportVolume",
 		"PUT",
@@ -205,7 +456,35 @@ var routes = Routes{
 		"VolumeJobStatus",
 		"GET",
 		VOLUME_BASE_PATH + "/job/{uuid}",
-		HandlerGetVolumeJobStatus,
+		HandlerGetJobStatus,
+	},
+	Route{
+		"VolumeJobResult",
+		"GET",
+		VOLUME_BASE_PATH + "/job/{uuid}/result",
+		HandlerGetJobResult,
+	},
+	Route{
+		"VolumeBatch",
+		"POST",
+		VOLUME_BASE_PATH + "/batch",
+		HandlerVolumeBatch,
+	},
+
+	/*
+		Unmanaged Volume Routes
+	*/
+	Route{
+		"ListUnmanagedVolumes",
+		"GET",
+		UNMANAGED_BASE_PATH + "/volumes",
+		HandlerGetUnmanagedVolumes,
+	},
+	Route{
+		"ListUnmanagedLUs",
+		"GET",
+		UNMANAGED_BASE_PATH + "/lus",
+		HandlerGetUnmanagedLUs,
 	},
 
 	/*
@@ -223,6 +502,24 @@ var routes = Routes{
 		HOST_BASE_PATH + "/{hostgroup}",
 		HandlerGetHostGroup,
 	},
+	Route{
+		"GetHostGroupLunMap",
+		"GET",
+		HOST_BASE_PATH + "/{hostgroup}/luns",
+		HandlerGetHostGroupLunMap,
+	},
+	Route{
+		"GetHostGroupVisibility",
+		"GET",
+		HOST_BASE_PATH + "/{hostgroup}/visibility",
+		HandlerGetHostGroupVisibility,
+	},
+	Route{
+		"GetInitiatorVisibility",
+		"GET",
+		INITIATOR_BASE_PATH + "/{initiator}",
+		HandlerGetInitiatorVisibility,
+	},
 	Route{
 		"CreateHostGroup",
 		"POST",
@@ -0,0 +1,59 @@
+package znstor
+
+import (
+	"github.com/d-helios/znstord/stmf"
+)
+
+// luSessions - sessions through which logical unit is accessible.
+// Session matches if its initiator and target are covered by one of the LU views.
+func luSessions(lu *stmf.LogicalUnit) ([]stmf.Session, error) {
+	views, err := lu.ListView()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(views) == 0 {
+		return nil, nil
+	}
+
+	targets, err := stmf.ListTargets()
+	if err != nil {
+		return nil, err
+	}
+
+	hostGroups, err := stmf.ListHostGroup("")
+	if err != nil {
+		return nil, err
+	}
+
+	targetGroups, err := stmf.ListTargetGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	hgMembers := make(map[string][]string)
+	for _, hg := range hostGroups {
+		hgMembers[hg.HostGroup] = hg.Members
+	}
+
+	tgMembers := make(map[string][]string)
+	for _, tg := range targetGroups {
+		tgMembers[tg.TargetGroup] = tg.TargetPortGroup
+	}
+
+	var sessions []stmf.Session
+
+	for _, target := range targets {
+		for _, session := range target.Sessions {
+			for _, view := range views {
+				if (view.HostGroup == "All" || checkOption(session.Initiator, hgMembers[view.HostGroup])) &&
+					(view.TargetGroup == "All" || checkOption(target.Target, tgMembers[view.TargetGroup])) {
+					sessions = append(sessions, session)
+					break
+				}
+			}
+		}
+	}
+
+	return sessions, nil
+}
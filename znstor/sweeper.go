@@ -0,0 +1,77 @@
+package znstor
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/d-helios/znstord/zfs"
+)
+
+// StartDeleteSweeper - resume destroy of volumes left marked as deleting
+// (for example after daemon restart in the middle of destroy).
+// Sweep is performed at startup and then every deleteSweepInterval.
+func StartDeleteSweeper() {
+	go func() {
+		for {
+			sweepDeletingVolumes()
+			time.Sleep(deleteSweepInterval)
+		}
+	}()
+}
+
+func sweepDeletingVolumes() {
+	volumes, err := zfs.ListDatasetProps(zfs.Volume, "", true, 0, "custom:sflag")
+	if err != nil {
+		log.Printf("sweeper: can't list volumes. Err: %s", err.Error())
+		return
+	}
+
+	for _, volume := range volumes {
+		if volume["custom:sflag"] != sflagDeleting {
+			continue
+		}
+
+		if isPrivatePool(strings.Split(volume["name"], "/")[0]) {
+			continue
+		}
+
+		log.Printf("sweeper: resume destroy of volume %s", volume["name"])
+		if err := sweepVolume(volume["name"]); err != nil {
+			log.Printf("sweeper: can't destroy volume %s. Err: %s", volume["name"], err.Error())
+		}
+	}
+}
+
+func sweepVolume(zvol string) error {
+	keys := []string{zvolLockKey(zvol)}
+
+	lu, err := lookupLuByZvol(zvol)
+	if err != nil {
+		return err
+	}
+	if lu != nil {
+		keys = append(keys, luLockKey(lu.LUName))
+	}
+
+	unlock := locks.Lock(keys...)
+	defer unlock()
+
+	// flag could be changed while waiting for locks, for example destroy
+	// was rolled back by atomic batch
+	sflag, err := zvolFlag(zvol)
+	if err != nil {
+		if errors.Is(err, zfs.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	if sflag != sflagDeleting {
+		log.Printf("sweeper: volume %s is no longer marked as deleting", zvol)
+		return nil
+	}
+
+	return resumeVolDestroy(zvol)
+}
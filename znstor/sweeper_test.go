@@ -0,0 +1,136 @@
+package znstor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fake zfs keeps service flag of the single volume in the state directory
+// and records destroy. stmfadm reports no logical units.
+const (
+	fakeZfsScript = `#!/bin/sh
+state=$(dirname "$0")
+eval last=\${$#}
+case "$1" in
+list) printf '%s\t%s\n' "$last" "$(cat "$state/sflag")" ;;
+set) echo "${2#custom:sflag=}" > "$state/sflag" ;;
+destroy) echo "$last" > "$state/destroyed" ;;
+esac
+`
+	fakeStmfadmScript = "#!/bin/sh\n"
+)
+
+// fakeCommands - put fake zfs and stmfadm first in PATH.
+// Returns state directory and function, which restores PATH.
+func fakeCommands(t *testing.T, sflag string) (string, func()) {
+	return fakeCommandsDir(t, map[string]string{
+		"zfs":     fakeZfsScript,
+		"stmfadm": fakeStmfadmScript,
+		"sflag":   sflag + "\n",
+	})
+}
+
+// fakeCommandsDir - write files (commands and their state) to temporary
+// directory and put it first in PATH
+func fakeCommandsDir(t *testing.T, files map[string]string) (string, func()) {
+	dir, err := ioutil.TempDir("", "znstor-fake")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+
+	return dir, func() {
+		os.Setenv("PATH", path)
+		os.RemoveAll(dir)
+	}
+}
+
+// waitLockWaiters - wait until lock of the key is held or awaited by n callers
+func waitLockWaiters(t *testing.T, key string, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+
+	for time.Now().Before(deadline) {
+		locks.mu.Lock()
+		l, ok := locks.locks[key]
+		refs := 0
+		if ok {
+			refs = l.refs
+		}
+		locks.mu.Unlock()
+
+		if refs >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("%s: %d lock waiters not reached", key, n)
+}
+
+func readState(dir, name string) string {
+	data, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func TestSweepVolumeDestroysDeleting(t *testing.T) {
+	zvol := "tank/domain/project/vol1"
+	dir, restore := fakeCommands(t, sflagDeleting)
+	defer restore()
+
+	if err := sweepVolume(zvol); err != nil {
+		t.Fatal(err)
+	}
+
+	if destroyed := readState(dir, "destroyed"); destroyed != zvol {
+		t.Errorf("destroyed %q, expected %q", destroyed, zvol)
+	}
+}
+
+func TestSweepVolumeAfterBatchRollback(t *testing.T) {
+	zvol := "tank/domain/project/vol1"
+	dir, restore := fakeCommands(t, sflagDeleting)
+	defer restore()
+
+	// atomic batch marked volume as deleting and holds its lock
+	unlock := locks.Lock(zvolLockKey(zvol))
+
+	done := make(chan error)
+	go func() {
+		done <- sweepVolume(zvol)
+	}()
+
+	// sweeper listed volume as deleting and waits for the lock
+	waitLockWaiters(t, zvolLockKey(zvol), 2)
+
+	// batch failed, undo restores managed flag and releases locks
+	if err := markVolManaged(zvol); err != nil {
+		unlock()
+		t.Fatal(err)
+	}
+	unlock()
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if destroyed := readState(dir, "destroyed"); destroyed != "" {
+		t.Errorf("volume %s destroyed after rollback", destroyed)
+	}
+	if sflag := readState(dir, "sflag"); sflag != sflagManaged {
+		t.Errorf("sflag %q, expected %q", sflag, sflagManaged)
+	}
+}
@@ -1,7 +1,10 @@
 package znstor
 
 import (
-	"sync"
+	"time"
+
+	"github.com/d-helios/znstord/stmf"
+	"github.com/d-helios/znstord/zfs"
 )
 
 // Constants
@@ -10,20 +13,69 @@ const (
 	asyncOptStatusInProgress          = "In Progress"
 	asyncOptStatusCompletedSuccefully = "Completed Successfully"
 	requestPayloadMaxSize             = 8192
+	batchPayloadMaxSize               = 1 << 20
 	sflagManaged                      = "managed_by_znstor"
 	sflagDeleting                     = "deleting"
+	sflagReleased                     = "released_by_znstor"
+	volStateHealthy                   = "healthy"
+	volStateDeleting                  = "deleting"
+	deleteSweepInterval               = 5 * time.Minute
+	inventoryRefreshInterval          = time.Minute
+	inventoryRefreshAttempts          = 3
+	scrubPollInterval                 = 30 * time.Second
+	idempotencyDefaultWindow          = 24 * time.Hour
+	moveSnapshotPrefix                = "znstor_move_"
+	propMaxProvisioned                = "custom:max_provisioned"
+	propOvercommitRatio               = "custom:overcommit_ratio"
+	internalPropNamespace             = "custom:"
+	userPropNameMaxLength             = 256
+	userPropValueMaxLength            = 8191
+)
+
+// Resize directions
+const (
+	resizeAny = iota
+	resizeGrow
+	resizeShrink
 )
 
 var (
-	privatePoolList = []string{"rpool", "zpool"}
-	vol_mutex       = &sync.Mutex{}
+	privatePoolList        = []string{"rpool", "zpool", "zroot"}
+	validSyncValues        = []string{"standard", "always", "disabled"}
+	validLogbiasValues     = []string{"latency", "throughput"}
+	validCacheValues       = []string{"all", "none", "metadata"}
+	validOnOffValues       = []string{"on", "off"}
+	validDedupValues       = []string{"on", "off", "verify", "sha256", "sha256,verify"}
+	validCompressionValues = []string{"on", "off", "lzjb", "zle", "lz4", "gzip",
+		"gzip-1", "gzip-2", "gzip-3", "gzip-4", "gzip-5", "gzip-6", "gzip-7", "gzip-8", "gzip-9"}
+)
+
+// Size bounds of the request values
+const (
+	volSizeMin      uint64 = 1 << 20
+	sizeMax         uint64 = 1 << 60
+	volBlockSizeMin uint64 = 512
+	volBlockSizeMax uint64 = 128 << 10
+	luBlockSizeMin  uint64 = 512
+	luBlockSizeMax  uint64 = 4096
+	nameMaxLength          = 255
 )
 
 // Configuration structure
 type ServerData struct {
-	Listen string   `json:"listen"` // Listen address. ex: 127.0.0.1
-	Auth   AuthData `json:"auth"`
-	StmfHa bool     `json:"stmfhaEnabled"`
+	Listen string    `json:"listen"` // Listen address. ex: 127.0.0.1
+	Auth   AuthData  `json:"auth"`
+	Admin  AuthData  `json:"admin"` // credentials of the pool maintenance api
+	StmfHa bool      `json:"stmfhaEnabled"`
+	Luns   *LunRange `json:"luns"` // range of automatically allocated LUNs
+
+	// seconds to keep responses of requests with Idempotency-Key
+	IdempotencyWindow uint64 `json:"idempotencyWindow"`
+}
+
+type LunRange struct {
+	Min uint64 `json:"min"`
+	Max uint64 `json:"max"`
 }
 
 type AuthData struct {
@@ -35,8 +87,53 @@ type AuthData struct {
 
 // Responce Structures
 type RespMsg struct {
-	Subject string `json:"subject"`
-	Msg     string `json:"message"`
+	Subject string       `json:"subject"`
+	Code    string       `json:"code,omitempty"`
+	Msg     string       `json:"message"`
+	Fields  []FieldError `json:"fields,omitempty"`
+}
+
+// Validation error of the request field. Nested fields are dot separated (ex: exports[0].lun)
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error codes of RespMsg
+const (
+	codeNotFound             = "not_found"
+	codeAlreadyExists        = "already_exists"
+	codeBusy                 = "busy"
+	codePermissionDenied     = "permission_denied"
+	codeInvalidArgument      = "invalid_argument"
+	codeBackendFailure       = "backend_failure"
+	codeBadRequest           = "bad_request"
+	codeNotEmpty             = "not_empty"
+	codeIdempotencyKeyReused = "idempotency_key_reused"
+	codeRequestInProgress    = "request_in_progress"
+)
+
+// Volume representation. Logical unit together with the state of its zvol
+type Volume struct {
+	stmf.LogicalUnit
+	State       string             `json:"State"`
+	Zvol        *zfs.VolDataset    `json:"Zvol,omitempty"`
+	Transitions []StatusTransition `json:"Transitions,omitempty"`
+	Properties  zfs.Properties     `json:"Properties,omitempty"`
+}
+
+// Logical unit operational status change performed by request
+type StatusTransition struct {
+	From string `json:"From"`
+	To   string `json:"To"`
+	Time string `json:"Time"`
+}
+
+// Zvol not managed by znstor
+type UnmanagedVolume struct {
+	Zvol    string `json:"zvol"`
+	VolSize uint64 `json:"volsize"`
+	LUName  string `json:"lu,omitempty"`
 }
 
 // Options volume create / update functions
@@ -45,7 +142,21 @@ type ZVolOptions struct {
 	Reservation  uint64 `json:"reservation,omitempty"`
 	Dedup        string `json:"dedup,omitempty"`
 	Compression  string `json:"compression,omitempty"`
-	Thin         bool   `json:"thin,omitempty"`
+	Thin         *bool  `json:"thin,omitempty"`
+	LuBlockSize  uint64 `json:"lu_blocksize,omitempty"`
+	WriteCache   *bool  `json:"writecache,omitempty"`
+}
+
+// Defaults of the new project volumes
+type ProjectDefaults struct {
+	VolBlockSize uint64 `json:"volblocksize,omitempty"`
+	Compression  string `json:"compression,omitempty"`
+	Dedup        string `json:"dedup,omitempty"`
+	Thin         *bool  `json:"thin,omitempty"`
+	LuBlockSize  uint64 `json:"lu_blocksize,omitempty"`
+	WriteCache   *bool  `json:"writecache,omitempty"`
+	Hostgroup    string `json:"hostgroup,omitempty"`
+	Targetgroup  string `json:"targetgroup,omitempty"`
 }
 
 // Options to represent filesystem dataset
@@ -69,8 +180,67 @@ type ZFilesystemOptions struct {
 
 // Projects representation
 type Project struct {
-	Dataset string             `json:"project"`
-	Options ZFilesystemOptions `json:"options"`
+	Dataset    string             `json:"project"`
+	Options    ZFilesystemOptions `json:"options"`
+	Properties zfs.Properties     `json:"properties,omitempty"`
+}
+
+// Domain representation. Domain is a pool/domain dataset, it could exist on several pools
+type Domain struct {
+	Domain string       `json:"domain"`
+	Pools  []DomainPool `json:"pools"`
+}
+
+type DomainPool struct {
+	Pool     string             `json:"pool"`
+	Projects int                `json:"projects"`
+	Options  ZFilesystemOptions `json:"options"`
+}
+
+// LUNs visible to host group
+type LunMap struct {
+	HostGroup  string        `json:"hostgroup"`
+	Entries    []LunMapEntry `json:"entries"`
+	Collisions []uint64      `json:"collisions,omitempty"` // LUNs used by several logical units
+}
+
+type LunMapEntry struct {
+	LUN         uint64 `json:"lun"`
+	LUName      string `json:"LUName"`
+	Alias       string `json:"alias"`
+	Zvol        string `json:"zvol"`
+	Project     string `json:"project"`
+	HostGroup   string `json:"hostgroup"`
+	TargetGroup string `json:"targetgroup"`
+	ViewEntry   uint64 `json:"viewentry"`
+}
+
+// Host groups of initiator or host group members and logical units visible to them
+type Visibility struct {
+	Initiator  string        `json:"initiator,omitempty"`
+	HostGroups []string      `json:"hostgroups"`
+	Members    []string      `json:"members,omitempty"`
+	Volumes    []LunMapEntry `json:"volumes"`
+}
+
+// Project provisioning report
+type ProjectCapacity struct {
+	Project         string  `json:"project"`
+	Quota           uint64  `json:"quota"`
+	Used            uint64  `json:"used"`
+	UsedBySnapshots uint64  `json:"usedbysnapshots"`
+	Available       uint64  `json:"available"`
+	Volumes         uint64  `json:"volumes"`
+	Provisioned     uint64  `json:"provisioned"`
+	MaxProvisioned  uint64  `json:"max_provisioned,omitempty"`
+	OvercommitRatio float64 `json:"overcommit_ratio,omitempty"`
+	ProvisionLimit  uint64  `json:"provision_limit,omitempty"`
+}
+
+// Pool representation
+type PoolInfo struct {
+	zfs.Pool
+	Status *zfs.PoolStatus `json:"status,omitempty"`
 }
 
 // Filesystem representation
@@ -90,15 +260,82 @@ type ZVolCreateRequest struct {
 	Guid    string      `json:"guid,omitempty"`
 	Serial  string      `json:"serial,omitempty"`
 	Options ZVolOptions `json:"options,omitempty"`
+
+	// Views added during creation. Project default groups are used if omitted
+	Exports []ExportRequest `json:"exports,omitempty"`
+}
+
+// Batch of volume operations. Volume is LU GUID, not used by create.
+// Export options are used by export and unexport operations
+type BatchRequest struct {
+	Atomic     bool             `json:"atomic,omitempty"`
+	Operations []BatchOperation `json:"operations"`
+}
+
+type BatchOperation struct {
+	Op       string             `json:"op"`
+	Volume   string             `json:"volume,omitempty"`
+	Create   *ZVolCreateRequest `json:"create,omitempty"`
+	Snapshot string             `json:"snapshot,omitempty"`
+	Export   *ExportRequest     `json:"export,omitempty"`
+}
+
+// Batch job result
+type BatchResult struct {
+	Atomic bool               `json:"atomic"`
+	Status string             `json:"status"`
+	Items  []*BatchItemResult `json:"items"`
+}
+
+type BatchItemResult struct {
+	Index  int         `json:"index"`
+	Op     string      `json:"op"`
+	Volume string      `json:"volume,omitempty"`
+	Status string      `json:"status"`
+	Code   string      `json:"code,omitempty"`
+	Error  string      `json:"error,omitempty"`
+	Result interface{} `json:"result,omitempty"`
 }
 
 type ZVolCloneRequest struct {
-	Alias  string `json:"alias"`
-	Serial string `json:"serial,omitempty"`
+	Alias   string          `json:"alias"`
+	Serial  string          `json:"serial,omitempty"`
+	Exports []ExportRequest `json:"exports,omitempty"`
+}
+
+type ZVolRenameRequest struct {
+	Alias string `json:"alias"`
+	Force bool   `json:"force,omitempty"`
+}
+
+type ZVolMoveRequest struct {
+	Pool    string `json:"pool,omitempty"`
+	Project string `json:"project"`
+	Force   bool   `json:"force,omitempty"`
+}
+
+type ZVolAdoptRequest struct {
+	Zvol  string `json:"zvol"`
+	Force bool   `json:"force,omitempty"`
+}
+
+// Modify volume properties. Only specified fields are changed
+type ZVolPatchRequest struct {
+	WriteProtect       *bool   `json:"write_protect,omitempty"`
+	WriteCacheDisabled *bool   `json:"write_cache_disabled,omitempty"`
+	VendorID           *string `json:"vendor_id,omitempty"`
+	ProductID          *string `json:"product_id,omitempty"`
+	ManagementURL      *string `json:"management_url,omitempty"`
+	Sync               *string `json:"sync,omitempty"`
+	Logbias            *string `json:"logbias,omitempty"`
+	Primarycache       *string `json:"primarycache,omitempty"`
+	Secondarycache     *string `json:"secondarycache,omitempty"`
+	Copies             *uint64 `json:"copies,omitempty"`
 }
 
 type ZvolResizeRequest struct {
 	VolSize uint64 `json:"volsize"`
+	Force   bool   `json:"force,omitempty"`
 }
 
 type FilesystemCloneRequest struct {
@@ -115,10 +352,14 @@ type FilesystemRequest struct {
 	Compression    string `json:"compression,omitempty"`
 	Dedup          string `json:"dedup,omitempty"`
 	Atime          string `json:"atime,omitempty"`
+
+	// Provisioning limits of the project volumes. Zero removes the limit.
+	MaxProvisioned  *uint64  `json:"max_provisioned,omitempty"`
+	OvercommitRatio *float64 `json:"overcommit_ratio,omitempty"`
 }
 
 type TpgCreateRequest struct {
-	portals []string `json:"portals,omitempty"`
+	Portals []string `json:"portals,omitempty"`
 }
 
 type TargetCreateRequest struct {
@@ -127,8 +368,12 @@ type TargetCreateRequest struct {
 	Tpg   string `json:"tpgs,omitempty"`
 }
 
+// Lun is allocated automatically if omitted
 type ExportRequest struct {
 	Hostgroup   string `json:"hostgroup,omitempty"`
 	Targetgroup string `json:"targetgroup,omitempty"`
-	Lun         int64  `json:"lun,omitempty"`
+	Lun         *int64 `json:"lun,omitempty"`
 }
+
+// User properties to set. Null value removes local value (zfs inherit)
+type UserPropertiesRequest map[string]*string
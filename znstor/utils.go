@@ -2,6 +2,7 @@ package znstor
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -19,6 +20,10 @@ func IsValueInArray(value interface{}, list []interface{}) bool {
 	return false
 }
 
+func isPrivatePool(pool string) bool {
+	return checkOption(pool, privatePoolList)
+}
+
 func checkOption(prop string, validOpts []string) bool {
 	for _, b := range validOpts {
 		if b == prop {
@@ -69,11 +74,19 @@ func IsVolumeBelongsToProject(basepath string, lu stmf.LogicalUnit) bool {
 }
 
 func sendMessage(w http.ResponseWriter, httpStatusCode uint64, subject, message string) {
-	msg := RespMsg{
+	sendCodedMessage(w, httpStatusCode, subject, "", message)
+}
+
+// sendCodedMessage - send message with machine readable error code
+func sendCodedMessage(w http.ResponseWriter, httpStatusCode uint64, subject, code, message string) {
+	sendRespMsg(w, httpStatusCode, RespMsg{
 		Subject: subject,
+		Code:    code,
 		Msg:     message,
-	}
+	})
+}
 
+func sendRespMsg(w http.ResponseWriter, httpStatusCode uint64, msg RespMsg) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(int(httpStatusCode))
 
@@ -83,3 +96,64 @@ func sendMessage(w http.ResponseWriter, httpStatusCode uint64, subject, message
 		log.Printf("sendMessage: %q", msg)
 	}
 }
+
+// errorStatuses - http status of the classified errors (see ErrorKind of the zfs, stmf, itadm errors)
+var errorStatuses = map[string]uint64{
+	codeNotFound:         http.StatusNotFound,
+	codeAlreadyExists:    http.StatusConflict,
+	codeBusy:             http.StatusLocked,
+	codePermissionDenied: http.StatusForbidden,
+	codeInvalidArgument:  http.StatusUnprocessableEntity,
+	codeBackendFailure:   http.StatusInternalServerError,
+}
+
+// classifiedError - error which knows its kind
+type classifiedError interface {
+	ErrorKind() string
+	Message() string
+}
+
+// sendError - send error of the failed operation.
+// Status and code are chosen by the kind of the error. Debug details
+// (command line, stderr) are logged and never sent to the client.
+func sendError(w http.ResponseWriter, subject string, err error) {
+	log.Printf("%s: %s", subject, err)
+
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		sendRespMsg(w, http.StatusUnprocessableEntity, RespMsg{
+			Subject: subject,
+			Code:    codeInvalidArgument,
+			Msg:     validationErr.Message(),
+			Fields:  validationErr.Fields,
+		})
+		return
+	}
+
+	code, message := publicError(err)
+	status, ok := errorStatuses[code]
+	if !ok {
+		status = http.StatusBadRequest
+	}
+	sendCodedMessage(w, status, subject, code, message)
+}
+
+// publicError - code and message of the error, which could be reported to
+// the client: without command line and stderr of the failed command.
+// Validation errors are reported with messages of the invalid fields.
+func publicError(err error) (string, string) {
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		return codeInvalidArgument, validationErr.Error()
+	}
+
+	var ce classifiedError
+	if errors.As(err, &ce) {
+		if _, ok := errorStatuses[ce.ErrorKind()]; ok {
+			return ce.ErrorKind(), ce.Message()
+		}
+		return codeBadRequest, ce.Message()
+	}
+
+	return codeBadRequest, err.Error()
+}
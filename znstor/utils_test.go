@@ -0,0 +1,36 @@
+package znstor
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/d-helios/znstord/zfs"
+)
+
+func TestPublicError(t *testing.T) {
+	tests := []struct {
+		err     error
+		code    string
+		message string
+	}{
+		{&zfs.Error{
+			Err:    errors.New("cannot destroy 'tank/vol': dataset is busy"),
+			Debug:  "zfs destroy tank/vol",
+			Stderr: "cannot destroy 'tank/vol': dataset is busy",
+			Kind:   zfs.KindBusy,
+		}, codeBusy, "cannot destroy 'tank/vol': dataset is busy"},
+		{&Error{Err: errors.New("Volume not found"), Debug: "LU: 600144F0", Kind: codeNotFound},
+			codeNotFound, "Volume not found"},
+		{&Error{Err: errors.New("Batch has no operations"), Debug: "request"}, codeBadRequest, "Batch has no operations"},
+		{&ValidationError{Fields: []FieldError{{Field: "alias", Message: "must not be empty"}}},
+			codeInvalidArgument, "Invalid request: alias: must not be empty"},
+		{errors.New("unexpected EOF"), codeBadRequest, "unexpected EOF"},
+	}
+
+	for _, test := range tests {
+		code, message := publicError(test.err)
+		if code != test.code || message != test.message {
+			t.Errorf("%v: %s %q, expected %s %q", test.err, code, message, test.code, test.message)
+		}
+	}
+}
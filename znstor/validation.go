@@ -0,0 +1,453 @@
+package znstor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+var (
+	// zfs dataset component, snapshot, host, target and port group names.
+	// Spaces are not allowed: option strings are joined and split by spaces.
+	nameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.:-]*$`)
+	// naming authority is case insensitive (RFC 3722 maps it to lowercase)
+	iqnRegexp  = regexp.MustCompile(`^iqn\.[0-9]{4}-[0-9]{2}\.[A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?(:[!-~]+)?$`)
+	euiRegexp  = regexp.MustCompile(`^eui\.[0-9A-Fa-f]{16}$`)
+	wwnRegexp  = regexp.MustCompile(`^wwn\.[0-9A-Fa-f]{16}$`)
+	guidRegexp = regexp.MustCompile(`^[0-9A-Fa-f]{32}$`)
+	uuidRegexp = regexp.MustCompile(`^[0-9A-Fa-f-]{32,36}$`)
+)
+
+// Checks of the route path variables
+var pathVarChecks = map[string]func(string) string{
+	"domain":            checkName,
+	"pool":              checkName,
+	"project":           checkName,
+	"filesystem":        checkName,
+	"snapshot":          checkName,
+	"hostgroup":         checkName,
+	"targetgroup":       checkName,
+	"target_port_group": checkName,
+	"volume":            checkGuid,
+	"initiator":         checkScsiName,
+	"member":            checkScsiName,
+	"target":            checkScsiName,
+	"uuid":              checkUuid,
+	"compression": func(value string) string {
+		return checkEnum(value, validCompressionValues)
+	},
+}
+
+// ValidateVars - reject request if path variables are not valid names.
+// Path variables are passed to zfs, stmfadm and itadm as is.
+func ValidateVars(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e := &ValidationError{}
+		for name, value := range mux.Vars(r) {
+			if check, ok := pathVarChecks[name]; ok {
+				e.check(name, check(value))
+			}
+		}
+
+		if err := e.err(); err != nil {
+			sendError(w, traceFunctionName(), err)
+			return
+		}
+
+		inner.ServeHTTP(w, r)
+	})
+}
+
+// validator - request which checks its fields
+type validator interface {
+	Validate() error
+}
+
+// decodeRequest - decode JSON payload into req and validate it.
+// Unknown fields are rejected.
+func decodeRequest(r *http.Request, req interface{}, maxSize int64) error {
+	decoder := json.NewDecoder(io.LimitReader(r.Body, maxSize))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(req); err != nil {
+		return decodeError(err)
+	}
+
+	if v, ok := req.(validator); ok {
+		return v.Validate()
+	}
+	return nil
+}
+
+// decodeError - report unknown fields and values of wrong type as field errors
+func decodeError(err error) error {
+	if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+		return &ValidationError{Fields: []FieldError{{
+			Field:   typeErr.Field,
+			Message: fmt.Sprintf("%s expected, got %s", typeErr.Type.Kind(), typeErr.Value),
+		}}}
+	}
+
+	if strings.HasPrefix(err.Error(), "json: unknown field ") {
+		field, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+		return &ValidationError{Fields: []FieldError{{Field: field, Message: "unknown field"}}}
+	}
+
+	return err
+}
+
+// checkName - zfs name component, host, target or port group name
+func checkName(name string) string {
+	switch {
+	case name == "":
+		return "must not be empty"
+	case len(name) > nameMaxLength:
+		return fmt.Sprintf("must not be longer than %d characters", nameMaxLength)
+	case !nameRegexp.MatchString(name):
+		return "must start with a letter or digit and contain only letters, digits, '_', '.', ':' and '-'"
+	}
+	return ""
+}
+
+func checkOptionalName(name string) string {
+	if name == "" {
+		return ""
+	}
+	return checkName(name)
+}
+
+// checkGroupName - host or target group of export. COMSTAR reports views
+// exported to all hosts or targets with group "All", so the name is reserved.
+func checkGroupName(name string) string {
+	if name == hostGroupAll {
+		return "All is reserved, omit group to export to all hosts or targets"
+	}
+	return checkOptionalName(name)
+}
+
+// checkDatasetName - full dataset name (ex: tank/domain/project/volume)
+func checkDatasetName(name string) string {
+	if name == "" {
+		return "must not be empty"
+	}
+	for _, component := range strings.Split(name, "/") {
+		if msg := checkName(component); msg != "" {
+			return fmt.Sprintf("component %q %s", component, msg)
+		}
+	}
+	return ""
+}
+
+// checkScsiName - initiator or target name in iqn, eui or wwn format
+func checkScsiName(name string) string {
+	if iqnRegexp.MatchString(name) || euiRegexp.MatchString(name) || wwnRegexp.MatchString(name) {
+		return ""
+	}
+	return "must be iqn.yyyy-mm.naming-authority[:name], eui.<16 hex digits> or wwn.<16 hex digits>"
+}
+
+func checkIqn(name string) string {
+	if iqnRegexp.MatchString(name) {
+		return ""
+	}
+	return "must be iqn.yyyy-mm.naming-authority[:name]"
+}
+
+// checkGuid - logical unit GUID
+func checkGuid(guid string) string {
+	if guidRegexp.MatchString(guid) {
+		return ""
+	}
+	return "must be 32 hex digits"
+}
+
+func checkUuid(id string) string {
+	if uuidRegexp.MatchString(id) {
+		return ""
+	}
+	return "must be UUID"
+}
+
+func checkEnum(value string, values []string) string {
+	if checkOption(value, values) {
+		return ""
+	}
+	return "must be one of: " + strings.Join(values, ", ")
+}
+
+func checkOptionalEnum(value string, values []string) string {
+	if value == "" {
+		return ""
+	}
+	return checkEnum(value, values)
+}
+
+func checkSize(size, min, max uint64) string {
+	if size < min || size > max {
+		return fmt.Sprintf("must be within %d-%d", min, max)
+	}
+	return ""
+}
+
+// checkBlockSize - power of two within min-max. Zero means default
+func checkBlockSize(size, min, max uint64) string {
+	if size == 0 {
+		return ""
+	}
+	if size&(size-1) != 0 || size < min || size > max {
+		return fmt.Sprintf("must be a power of two within %d-%d", min, max)
+	}
+	return ""
+}
+
+// checkText - printable ASCII characters without spaces
+func checkText(value string, max int) string {
+	if len(value) == 0 || len(value) > max {
+		return fmt.Sprintf("must be 1-%d characters", max)
+	}
+	for _, c := range value {
+		if c <= ' ' || c > '~' {
+			return "must contain only printable ASCII characters without spaces"
+		}
+	}
+	return ""
+}
+
+// checkPortal - IP address with optional port
+func checkPortal(portal string) string {
+	host := portal
+	if h, port, err := net.SplitHostPort(portal); err == nil {
+		if p, err := strconv.ParseUint(port, 10, 16); err != nil || p == 0 {
+			return "invalid port"
+		}
+		host = h
+	}
+	if net.ParseIP(host) == nil {
+		return "must be IP address with optional port"
+	}
+	return ""
+}
+
+// Validate - check volume create request
+func (req *ZVolCreateRequest) Validate() error {
+	e := &ValidationError{}
+	req.validate(e, "")
+	return e.err()
+}
+
+func (req *ZVolCreateRequest) validate(e *ValidationError, prefix string) {
+	e.check(prefix+"alias", checkName(req.Alias))
+	e.check(prefix+"volsize", checkSize(req.VolSize, volSizeMin, sizeMax))
+	if req.Guid != "" {
+		e.check(prefix+"guid", checkGuid(req.Guid))
+	}
+	if req.Serial != "" {
+		e.check(prefix+"serial", checkText(req.Serial, nameMaxLength))
+	}
+	req.Options.validate(e, prefix+"options.")
+	validateExports(e, prefix, req.Exports)
+}
+
+func (opts *ZVolOptions) validate(e *ValidationError, prefix string) {
+	e.check(prefix+"volblocksize", checkBlockSize(opts.VolBlockSize, volBlockSizeMin, volBlockSizeMax))
+	e.check(prefix+"reservation", checkSize(opts.Reservation, 0, sizeMax))
+	e.check(prefix+"dedup", checkOptionalEnum(opts.Dedup, validDedupValues))
+	e.check(prefix+"compression", checkOptionalEnum(opts.Compression, validCompressionValues))
+	e.check(prefix+"lu_blocksize", checkBlockSize(opts.LuBlockSize, luBlockSizeMin, luBlockSizeMax))
+}
+
+// Validate - check export request
+func (req *ExportRequest) Validate() error {
+	e := &ValidationError{}
+	req.validate(e, "")
+	return e.err()
+}
+
+func (req *ExportRequest) validate(e *ValidationError, prefix string) {
+	e.check(prefix+"hostgroup", checkGroupName(req.Hostgroup))
+	e.check(prefix+"targetgroup", checkGroupName(req.Targetgroup))
+	if req.Lun != nil && (*req.Lun < int64(lunMin) || *req.Lun > int64(lunMax)) {
+		e.check(prefix+"lun", fmt.Sprintf("must be within %d-%d", lunMin, lunMax))
+	}
+}
+
+func validateExports(e *ValidationError, prefix string, exports []ExportRequest) {
+	for i := range exports {
+		exports[i].validate(e, fmt.Sprintf("%sexports[%d].", prefix, i))
+	}
+}
+
+// Validate - check batch operations
+func (req *BatchRequest) Validate() error {
+	e := &ValidationError{}
+
+	if len(req.Operations) == 0 {
+		e.check("operations", "must not be empty")
+	}
+
+	for i, op := range req.Operations {
+		prefix := fmt.Sprintf("operations[%d].", i)
+
+		e.check(prefix+"op", checkEnum(op.Op,
+			[]string{batchOpCreate, batchOpSnapshot, batchOpExport, batchOpUnexport, batchOpDelete}))
+
+		if op.Op == batchOpCreate {
+			if op.Create == nil {
+				e.check(prefix+"create", "must be specified")
+			} else {
+				op.Create.validate(e, prefix+"create.")
+			}
+			continue
+		}
+
+		e.check(prefix+"volume", checkGuid(op.Volume))
+
+		switch op.Op {
+		case batchOpSnapshot:
+			e.check(prefix+"snapshot", checkName(op.Snapshot))
+		case batchOpExport, batchOpUnexport:
+			if op.Export == nil {
+				e.check(prefix+"export", "must be specified")
+			} else {
+				op.Export.validate(e, prefix+"export.")
+			}
+		}
+	}
+
+	return e.err()
+}
+
+// Validate - check volume clone request
+func (req *ZVolCloneRequest) Validate() error {
+	e := &ValidationError{}
+	e.check("alias", checkName(req.Alias))
+	if req.Serial != "" {
+		e.check("serial", checkText(req.Serial, nameMaxLength))
+	}
+	validateExports(e, "", req.Exports)
+	return e.err()
+}
+
+// Validate - check volume rename request
+func (req *ZVolRenameRequest) Validate() error {
+	e := &ValidationError{}
+	e.check("alias", checkName(req.Alias))
+	return e.err()
+}
+
+// Validate - check volume move request
+func (req *ZVolMoveRequest) Validate() error {
+	e := &ValidationError{}
+	e.check("pool", checkOptionalName(req.Pool))
+	e.check("project", checkName(req.Project))
+	return e.err()
+}
+
+// Validate - check volume adopt request
+func (req *ZVolAdoptRequest) Validate() error {
+	e := &ValidationError{}
+	e.check("zvol", checkDatasetName(req.Zvol))
+	return e.err()
+}
+
+// Validate - check volume resize request
+func (req *ZvolResizeRequest) Validate() error {
+	e := &ValidationError{}
+	e.check("volsize", checkSize(req.VolSize, volSizeMin, sizeMax))
+	return e.err()
+}
+
+// Validate - check values of volume properties modify request
+func (req *ZVolPatchRequest) Validate() error {
+	e := &ValidationError{}
+
+	if req.VendorID != nil {
+		e.check("vendor_id", checkText(*req.VendorID, 8))
+	}
+	if req.ProductID != nil {
+		e.check("product_id", checkText(*req.ProductID, 16))
+	}
+	if req.ManagementURL != nil && strings.ContainsAny(*req.ManagementURL, " \t") {
+		e.check("management_url", "spaces not allowed")
+	}
+	if req.Sync != nil {
+		e.check("sync", checkEnum(*req.Sync, validSyncValues))
+	}
+	if req.Logbias != nil {
+		e.check("logbias", checkEnum(*req.Logbias, validLogbiasValues))
+	}
+	if req.Primarycache != nil {
+		e.check("primarycache", checkEnum(*req.Primarycache, validCacheValues))
+	}
+	if req.Secondarycache != nil {
+		e.check("secondarycache", checkEnum(*req.Secondarycache, validCacheValues))
+	}
+	if req.Copies != nil && (*req.Copies < 1 || *req.Copies > 3) {
+		e.check("copies", "must be 1, 2 or 3")
+	}
+
+	return e.err()
+}
+
+// Validate - check domain and project create or modify request.
+// Zero sizes are not changed.
+func (req *FilesystemRequest) Validate() error {
+	e := &ValidationError{}
+	e.check("alias", checkOptionalName(req.Alias))
+	e.check("quota", checkSize(req.Quota, 0, sizeMax))
+	e.check("refquota", checkSize(req.Refquota, 0, sizeMax))
+	e.check("reservation", checkSize(req.Reservation, 0, sizeMax))
+	e.check("refreservation", checkSize(req.Refreservation, 0, sizeMax))
+	e.check("compression", checkOptionalEnum(req.Compression, validCompressionValues))
+	e.check("dedup", checkOptionalEnum(req.Dedup, validDedupValues))
+	e.check("atime", checkOptionalEnum(req.Atime, validOnOffValues))
+	if req.MaxProvisioned != nil {
+		e.check("max_provisioned", checkSize(*req.MaxProvisioned, 0, sizeMax))
+	}
+	if req.OvercommitRatio != nil && *req.OvercommitRatio < 0 {
+		e.check("overcommit_ratio", "must not be negative")
+	}
+	return e.err()
+}
+
+// Validate - check project defaults
+func (req *ProjectDefaults) Validate() error {
+	e := &ValidationError{}
+	e.check("volblocksize", checkBlockSize(req.VolBlockSize, volBlockSizeMin, volBlockSizeMax))
+	e.check("compression", checkOptionalEnum(req.Compression, validCompressionValues))
+	e.check("dedup", checkOptionalEnum(req.Dedup, validDedupValues))
+	e.check("lu_blocksize", checkBlockSize(req.LuBlockSize, luBlockSizeMin, luBlockSizeMax))
+	e.check("hostgroup", checkGroupName(req.Hostgroup))
+	e.check("targetgroup", checkGroupName(req.Targetgroup))
+	return e.err()
+}
+
+// Validate - check target port group create request
+func (req *TpgCreateRequest) Validate() error {
+	e := &ValidationError{}
+	if len(req.Portals) == 0 {
+		e.check("portals", "must not be empty")
+	}
+	for i, portal := range req.Portals {
+		e.check(fmt.Sprintf("portals[%d]", i), checkPortal(portal))
+	}
+	return e.err()
+}
+
+// Validate - check target create request
+func (req *TargetCreateRequest) Validate() error {
+	e := &ValidationError{}
+	if req.Iqn != "" {
+		e.check("iqn", checkIqn(req.Iqn))
+	}
+	e.check("alias", checkOptionalName(req.Alias))
+	e.check("tpgs", checkOptionalName(req.Tpg))
+	return e.err()
+}
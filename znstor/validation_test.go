@@ -0,0 +1,326 @@
+package znstor
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// invalidFields - names of the fields reported by validation error
+func invalidFields(t *testing.T, err error) []string {
+	if err == nil {
+		return nil
+	}
+
+	e, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("%v: ValidationError expected, got %T", err, err)
+	}
+
+	var fields []string
+	for _, field := range e.Fields {
+		fields = append(fields, field.Field)
+	}
+	return fields
+}
+
+func TestCheckName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"project1", true},
+		{"My_Project.v2:a-b", true},
+		{"0project", true},
+		{"All", true},
+		{strings.Repeat("a", nameMaxLength), true},
+		{"", false},
+		{strings.Repeat("a", nameMaxLength+1), false},
+		{"-project", false},
+		{".project", false},
+		{"my project", false},
+		{"tank/project", false},
+		{"project@snap", false},
+		{"project;rm", false},
+	}
+
+	for _, test := range tests {
+		if msg := checkName(test.name); (msg == "") != test.valid {
+			t.Errorf("%q: valid %v, message %q", test.name, test.valid, msg)
+		}
+	}
+
+	if msg := checkOptionalName(""); msg != "" {
+		t.Errorf("empty optional name: %q", msg)
+	}
+}
+
+func TestCheckGroupName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"", true},
+		{"hg1", true},
+		{"all", true},
+		{"All", false},
+		{"host group", false},
+	}
+
+	for _, test := range tests {
+		if msg := checkGroupName(test.name); (msg == "") != test.valid {
+			t.Errorf("%q: valid %v, message %q", test.name, test.valid, msg)
+		}
+	}
+}
+
+func TestCheckDatasetName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"tank/domain/project/vol1", true},
+		{"tank", true},
+		{"", false},
+		{"tank//vol1", false},
+		{"tank/domain/", false},
+		{"tank/my vol", false},
+		{"tank/vol1@snap", false},
+	}
+
+	for _, test := range tests {
+		if msg := checkDatasetName(test.name); (msg == "") != test.valid {
+			t.Errorf("%q: valid %v, message %q", test.name, test.valid, msg)
+		}
+	}
+}
+
+func TestCheckScsiName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"iqn.1986-03.com.sun:01:e00000000000.5a0b1c2d", true},
+		{"iqn.1991-05.com.microsoft:host-01.example.com", true},
+		{"iqn.2010-01.org.example", true},
+		{"iqn.1991-05.COM.Microsoft:HOST", true},
+		{"iqn.2010-01.org.example:", false},
+		{"iqn.2010-01.-example", false},
+		{"iqn.2010-01.example-", false},
+		{"iqn.10-01.org.example", false},
+		{"iqn.2010-1.org.example", false},
+		{"iqn.2010-01.org.example:my target", false},
+		{"IQN.2010-01.org.example", false},
+		{"eui.0123456789ABCDEF", true},
+		{"eui.0123456789abcdef", true},
+		{"eui.0123456789ABCDE", false},
+		{"eui.0123456789ABCDEG", false},
+		{"wwn.5000C50012345678", true},
+		{"wwn.5000C500123456789", false},
+		{"naa.5000C50012345678", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		if msg := checkScsiName(test.name); (msg == "") != test.valid {
+			t.Errorf("%q: valid %v, message %q", test.name, test.valid, msg)
+		}
+	}
+
+	if msg := checkIqn("eui.0123456789ABCDEF"); msg == "" {
+		t.Errorf("eui name accepted as iqn")
+	}
+}
+
+func TestCheckGuidUuid(t *testing.T) {
+	if msg := checkGuid("600144F0ABCDEF0123456789ABCDEF01"); msg != "" {
+		t.Errorf("valid guid: %q", msg)
+	}
+	for _, guid := range []string{"", "600144F0ABCDEF0123456789ABCDEF0", "600144F0ABCDEF0123456789ABCDEF0G", "600144f0-abcd-ef01-2345-6789abcdef01"} {
+		if msg := checkGuid(guid); msg == "" {
+			t.Errorf("%q: accepted as guid", guid)
+		}
+	}
+
+	for _, id := range []string{"0b5e2c3a-1d2e-4f5a-8b9c-0d1e2f3a4b5c", "0b5e2c3a1d2e4f5a8b9c0d1e2f3a4b5c"} {
+		if msg := checkUuid(id); msg != "" {
+			t.Errorf("%q: %s", id, msg)
+		}
+	}
+	for _, id := range []string{"", "job-1", "../../etc/passwd"} {
+		if msg := checkUuid(id); msg == "" {
+			t.Errorf("%q: accepted as uuid", id)
+		}
+	}
+}
+
+func TestCheckSizes(t *testing.T) {
+	tests := []struct {
+		size     uint64
+		min, max uint64
+		valid    bool
+	}{
+		{0, luBlockSizeMin, luBlockSizeMax, true},
+		{512, luBlockSizeMin, luBlockSizeMax, true},
+		{4096, luBlockSizeMin, luBlockSizeMax, true},
+		{256, luBlockSizeMin, luBlockSizeMax, false},
+		{8192, luBlockSizeMin, luBlockSizeMax, false},
+		{3000, luBlockSizeMin, luBlockSizeMax, false},
+		{128 << 10, volBlockSizeMin, volBlockSizeMax, true},
+		{256 << 10, volBlockSizeMin, volBlockSizeMax, false},
+	}
+
+	for _, test := range tests {
+		if msg := checkBlockSize(test.size, test.min, test.max); (msg == "") != test.valid {
+			t.Errorf("block size %d within %d-%d: valid %v, message %q", test.size, test.min, test.max, test.valid, msg)
+		}
+	}
+
+	if msg := checkSize(volSizeMin-1, volSizeMin, sizeMax); msg == "" {
+		t.Errorf("size below minimum accepted")
+	}
+	if msg := checkSize(sizeMax, volSizeMin, sizeMax); msg != "" {
+		t.Errorf("max size: %q", msg)
+	}
+}
+
+func TestCheckText(t *testing.T) {
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{"SUN", true},
+		{"COMSTAR1", true},
+		{"SUN-1.0", true},
+		{"12345678", true},
+		{"123456789", false},
+		{"", false},
+		{"SUN MICRO", false},
+		{"SUN\t", false},
+		{"ЖЖ", false},
+	}
+
+	for _, test := range tests {
+		if msg := checkText(test.value, 8); (msg == "") != test.valid {
+			t.Errorf("%q: valid %v, message %q", test.value, test.valid, msg)
+		}
+	}
+}
+
+func TestCheckPortal(t *testing.T) {
+	tests := []struct {
+		portal string
+		valid  bool
+	}{
+		{"10.0.0.1", true},
+		{"10.0.0.1:3260", true},
+		{"[fe80::1]:3260", true},
+		{"fe80::1", true},
+		{"10.0.0.1:0", false},
+		{"10.0.0.1:65536", false},
+		{"10.0.0.1:iscsi", false},
+		{"storage.example.com:3260", false},
+		{"10.0.0.256", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		if msg := checkPortal(test.portal); (msg == "") != test.valid {
+			t.Errorf("%q: valid %v, message %q", test.portal, test.valid, msg)
+		}
+	}
+}
+
+func TestDecodeRequest(t *testing.T) {
+	tests := []struct {
+		body   string
+		fields []string
+	}{
+		{`{"alias":"vol1","volsize":1073741824}`, nil},
+		{`{"alias":"vol1","volsize":1073741824,"size":1}`, []string{"size"}},
+		{`{"alias":"vol1","volsize":"1G"}`, []string{"volsize"}},
+		{`{"alias":"vol1","volsize":1073741824,"options":{"volblocksize":"8k"}}`, []string{"options.volblocksize"}},
+		{`{"alias":"my vol","volsize":1024}`, []string{"alias", "volsize"}},
+		{`{"alias":"vol1","volsize":1073741824,"exports":[{"hostgroup":"All","lun":16384}]}`,
+			[]string{"exports[0].hostgroup", "exports[0].lun"}},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("POST", "/volumes", strings.NewReader(test.body))
+
+		var req ZVolCreateRequest
+		fields := invalidFields(t, decodeRequest(r, &req, requestPayloadMaxSize))
+		if !reflect.DeepEqual(fields, test.fields) {
+			t.Errorf("%s: invalid fields %q, expected %q", test.body, fields, test.fields)
+		}
+	}
+
+	// malformed JSON is not a field error
+	r := httptest.NewRequest("POST", "/volumes", strings.NewReader(`{"alias":`))
+	var req ZVolCreateRequest
+	err := decodeRequest(r, &req, requestPayloadMaxSize)
+	if _, ok := err.(*ValidationError); err == nil || ok {
+		t.Errorf("malformed JSON: %v", err)
+	}
+}
+
+func TestBatchRequestValidate(t *testing.T) {
+	guid := "600144F0ABCDEF0123456789ABCDEF01"
+	create := &ZVolCreateRequest{Alias: "vol1", VolSize: 1 << 30}
+
+	tests := []struct {
+		req    BatchRequest
+		fields []string
+	}{
+		{BatchRequest{}, []string{"operations"}},
+		{BatchRequest{Operations: []BatchOperation{
+			{Op: batchOpCreate, Create: create},
+			{Op: batchOpSnapshot, Volume: guid, Snapshot: "snap1"},
+			{Op: batchOpExport, Volume: guid, Export: &ExportRequest{Hostgroup: "hg1"}},
+			{Op: batchOpUnexport, Volume: guid, Export: &ExportRequest{}},
+			{Op: batchOpDelete, Volume: guid},
+		}}, nil},
+		{BatchRequest{Operations: []BatchOperation{
+			{Op: "resize", Volume: guid},
+			{Op: batchOpCreate},
+			{Op: batchOpCreate, Create: &ZVolCreateRequest{Alias: "", VolSize: 1 << 30}},
+		}}, []string{"operations[0].op", "operations[1].create", "operations[2].create.alias"}},
+		{BatchRequest{Operations: []BatchOperation{
+			{Op: batchOpSnapshot, Volume: "vol1", Snapshot: ""},
+			{Op: batchOpExport, Volume: guid},
+			{Op: batchOpDelete, Volume: ""},
+		}}, []string{"operations[0].volume", "operations[0].snapshot", "operations[1].export", "operations[2].volume"}},
+	}
+
+	for i, test := range tests {
+		fields := invalidFields(t, test.req.Validate())
+		if !reflect.DeepEqual(fields, test.fields) {
+			t.Errorf("request %d: invalid fields %q, expected %q", i, fields, test.fields)
+		}
+	}
+}
+
+func TestZVolPatchRequestValidate(t *testing.T) {
+	copies := func(n uint64) *uint64 { return &n }
+
+	tests := []struct {
+		req    ZVolPatchRequest
+		fields []string
+	}{
+		{ZVolPatchRequest{}, nil},
+		{ZVolPatchRequest{VendorID: strPtr("SUN"), ProductID: strPtr("COMSTAR"), ManagementURL: strPtr(""),
+			Sync: strPtr("always"), Copies: copies(2)}, nil},
+		{ZVolPatchRequest{VendorID: strPtr("VENDOR123"), ManagementURL: strPtr("http://host/a b")},
+			[]string{"vendor_id", "management_url"}},
+		{ZVolPatchRequest{Sync: strPtr("sometimes"), Primarycache: strPtr("data"), Copies: copies(0)},
+			[]string{"sync", "primarycache", "copies"}},
+	}
+
+	for i, test := range tests {
+		fields := invalidFields(t, test.req.Validate())
+		if !reflect.DeepEqual(fields, test.fields) {
+			t.Errorf("request %d: invalid fields %q, expected %q", i, fields, test.fields)
+		}
+	}
+}
@@ -26,9 +26,8 @@ func Wrapper(inner http.Handler, name string, logfile io.Writer, login, password
 		pool := vars["pool"]
 
 		// TODO: declare privat pool list in configuration file
-		if pool == "rpool" || pool == "zroot" {
-			w.WriteHeader(http.StatusForbidden)
-			sendMessage(w, http.StatusForbidden, traceFunctionName(), "PERMISSION DENIED on POOL: "+pool)
+		if isPrivatePool(pool) {
+			sendCodedMessage(w, http.StatusForbidden, traceFunctionName(), codePermissionDenied, "PERMISSION DENIED on POOL: "+pool)
 			return
 		}
 
@@ -3,6 +3,8 @@ package znstor
 import (
 	"errors"
 	"fmt"
+	"log"
+	"path"
 	"strconv"
 	"strings"
 	"github.com/d-helios/znstord/stmf"
@@ -12,9 +14,23 @@ import (
 )
 
 func CreateVolume(basepath string, zvol ZVolCreateRequest) (*stmf.LogicalUnit, error) {
+	zvol, err := prepareVolumeCreate(basepath, zvol)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock := locks.Lock(volumeCreateLockKeys(basepath, zvol)...)
+	defer unlock()
+
+	return createVolume(basepath, zvol)
+}
+
+// prepareVolumeCreate - check create request and fill omitted options and
+// exports with project defaults
+func prepareVolumeCreate(basepath string, zvol ZVolCreateRequest) (ZVolCreateRequest, error) {
 	// check if alias is not empty
 	if zvol.Alias == "" {
-		return nil, &Error{
+		return zvol, &Error{
 			Err:    errors.New("Alias not specified"),
 			Debug:  fmt.Sprintf("request: %q", zvol),
 			Stderr: "",
@@ -23,7 +39,7 @@ func CreateVolume(basepath string, zvol ZVolCreateRequest) (*stmf.LogicalUnit, e
 
 	// check if size is specified
 	if zvol.VolSize == 0 {
-		return nil, &Error{
+		return zvol, &Error{
 			Err:    errors.New("VolSize not specified"),
 			Debug:  fmt.Sprintf("request: %q", zvol),
 			Stderr: "",
@@ -34,116 +50,522 @@ func CreateVolume(basepath string, zvol ZVolCreateRequest) (*stmf.LogicalUnit, e
 		zvol.Serial = uuid.NewV4().String()
 	}
 
+	defaults, err := getProjectDefaults(basepath)
+	if err != nil {
+		return zvol, err
+	}
+	zvol.Options = applyProjectDefaults(zvol.Options, defaults)
+
+	// export volume to project default host and target groups
+	if len(zvol.Exports) == 0 && (defaults.Hostgroup != "" || defaults.Targetgroup != "") {
+		zvol.Exports = []ExportRequest{{Hostgroup: defaults.Hostgroup, Targetgroup: defaults.Targetgroup}}
+	}
+
+	return zvol, nil
+}
+
+func volumeCreateLockKeys(basepath string, zvol ZVolCreateRequest) []string {
+	return append(exportLockKeys(zvol.Exports), projectLockKey(basepath), zvolLockKey(basepath+"/"+zvol.Alias))
+}
+
+// createVolume - create zvol, logical unit and views of prepared request.
+// Caller must hold volumeCreateLockKeys locks.
+func createVolume(basepath string, zvol ZVolCreateRequest) (*stmf.LogicalUnit, error) {
 	// Append options
-	zvolArgs := []string{}
+	zvolProps := zfs.PropertyMap{
+		"volblocksize": "8192",
+		"custom:sflag": sflagManaged,
+	}
 
-	if zvol.Options.VolBlockSize == 0 {
-		zvolArgs = append(zvolArgs, "-o volblocksize=8192")
-	} else {
-		zvolArgs = append(zvolArgs, "-o volblocksize="+strconv.FormatUint(
-			zvol.Options.VolBlockSize,
-			10,
-		))
+	if zvol.Options.VolBlockSize != 0 {
+		zvolProps["volblocksize"] = strconv.FormatUint(zvol.Options.VolBlockSize, 10)
 	}
 
 	if zvol.Options.Compression != "" {
-		zvolArgs = append(zvolArgs, "-o compression="+zvol.Options.Compression)
+		zvolProps["compression"] = zvol.Options.Compression
 	}
 
 	if zvol.Options.Dedup != "" {
-		zvolArgs = append(zvolArgs, "-o dedup="+zvol.Options.Dedup)
+		zvolProps["dedup"] = zvol.Options.Dedup
 	}
 
 	if zvol.Options.Reservation != 0 {
-		zvolArgs = append(zvolArgs, "-o reservation="+
-			strconv.FormatUint(zvol.Options.Reservation, 10))
+		zvolProps["reservation"] = strconv.FormatUint(zvol.Options.Reservation, 10)
 	}
 
-	zvolArgs = append(zvolArgs, "-o custom:sflag="+sflagManaged)
-
 	volName := zvol.Alias
 
+	if err := checkProvisioning(basepath, zvol.VolSize); err != nil {
+		return nil, err
+	}
+
 	// create volume
-	zfsVolume, err := zfs.CreateVolume(
+	zfsVolume, err := zfs.CreateVolumeWithProps(
 		basepath+"/"+volName,
-		strings.Join(zvolArgs, " "),
-		zvol.Options.Thin,
+		zvolProps,
+		zvol.Options.Thin != nil && *zvol.Options.Thin,
 		zvol.VolSize)
 
 	if err != nil {
 		return nil, err
 	}
 
-	stmfArgs := []string{"-p", "alias=" + zvol.Alias, "-p", "serial=" + zvol.Serial}
+	luProps := stmf.LuProperties{
+		Alias:     zvol.Alias,
+		Serial:    zvol.Serial,
+		BlockSize: zvol.Options.LuBlockSize,
+	}
+
+	// write cache disabled (wcd) is the inverse of writecache option
+	if zvol.Options.WriteCache != nil {
+		wcd := !*zvol.Options.WriteCache
+		luProps.WriteCacheDisabled = &wcd
+	}
 
-	stmfLu, err := stmf.CreateLu(
-		zfsVolume.Dataset,
-		strings.Join(stmfArgs, " "))
+	unlockComstar := locks.LockComstar()
+	stmfLu, err := stmf.CreateLuWithProps(zfsVolume.Dataset, luProps)
+	unlockComstar()
 
 	if err != nil {
+		destroyNewZvol(zfsVolume)
+		return nil, err
+	}
+
+	inv.SetZvolProp(zfsVolume.Dataset, "custom:sflag", sflagManaged)
+	inv.UpdateLu(stmfLu)
+
+	if err := exportNewVolume(stmfLu, zfsVolume, zvol.Exports); err != nil {
 		return nil, err
 	}
 
 	return stmfLu, nil
 }
 
-func VolResize(lu_uuid string, newSize uint64) error {
-	// check if new size is greater then old size
+func exportLockKeys(exports []ExportRequest) []string {
+	var keys []string
+	for _, export := range exports {
+		keys = append(keys, hostGroupLockKey(export.Hostgroup), targetGroupLockKey(export.Targetgroup))
+	}
+	return keys
+}
+
+// exportNewVolume - add views of just created volume. If any view could not be
+// added, logical unit and zvol are removed, so volume is created with all
+// requested exports or not created at all.
+// Caller must hold locks of the volume and groups.
+func exportNewVolume(lu *stmf.LogicalUnit, zfsVolume *zfs.Dataset, exports []ExportRequest) error {
+	if len(exports) == 0 {
+		return nil
+	}
+
+	var failed *ExportRequest
+	var err error
+
+	for i := range exports {
+		if _, err = addView(lu, exports[i]); err != nil {
+			failed = &exports[i]
+			break
+		}
+	}
+
+	if failed != nil {
+		rollbackCreateVolume(lu, zfsVolume)
+		code, message := publicError(err)
+		return &Error{
+			Err: fmt.Errorf("Can't export volume to host group %q, target group %q: %s. Volume is removed",
+				failed.Hostgroup, failed.Targetgroup, message),
+			Debug:  fmt.Sprintf("LU: %s, zvol: %s, err: %s", lu.LUName, zfsVolume.Dataset, err),
+			Stderr: "",
+			Kind:   code,
+		}
+	}
+	inv.UpdateLu(lu)
+
+	return nil
+}
+
+// rollbackCreateVolume - remove logical unit and zvol of partially created volume.
+// Caller must hold locks of the volume.
+func rollbackCreateVolume(lu *stmf.LogicalUnit, zfsVolume *zfs.Dataset) {
+	unlockComstar := locks.LockComstar()
+	err := lu.Delete(false)
+	unlockComstar()
+	if err != nil {
+		log.Printf("Rollback of volume %s failed. Can't delete LU %s: %s", zfsVolume.Dataset, lu.LUName, err.Error())
+		return
+	}
+	inv.RemoveLu(lu.LUName)
+
+	destroyNewZvol(zfsVolume)
+}
+
+// destroyNewZvol - remove just created zvol (or clone) of the volume, which
+// creation failed, so it isn't left invisible to API and counted in project
+// provisioning.
+func destroyNewZvol(zfsVolume *zfs.Dataset) {
+	if err := zfsVolume.DestroyWithFlags(zfs.DestroyFlags{}); err != nil {
+		log.Printf("Rollback of volume %s failed. Can't destroy zvol: %s", zfsVolume.Dataset, err.Error())
+		return
+	}
+	inv.RemoveZvol(zfsVolume.Dataset)
+}
+
+// VolResize - change volume size. Shrinking requires force and is refused
+// while the volume has views or active sessions. If quiesce is set, logical
+// unit is taken offline while zvol and logical unit sizes are changed.
+func VolResize(lu_uuid string, req ZvolResizeRequest, direction int, quiesce bool) (*Volume, error) {
 	lu, err := stmf.GetLu(lu_uuid)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	unlock := locks.Lock(luLockKey(lu.LUName), zvolLockKey(lu.GetZvol()), projectLockKey(path.Dir(lu.GetZvol())))
+	defer unlock()
+
+	zfsVolume, err := zfs.GetDataset(lu.GetZvol())
+	if err != nil {
+		return nil, err
 	}
 
-	if lu.Size > newSize {
-		return Error{
-			Err:    errors.New(fmt.Sprintf("Can't decrise volume size.")),
+	if err := zfsVolume.RefreshProps(); err != nil {
+		return nil, err
+	}
+	zvolProps := zfsVolume.Props.(*zfs.VolDataset)
+
+	if err := checkResize(lu, zvolProps, req, direction); err != nil {
+		return nil, err
+	}
+
+	if req.VolSize > zvolProps.Volsize {
+		if err := checkProvisioning(path.Dir(zfsVolume.Dataset), req.VolSize-zvolProps.Volsize); err != nil {
+			return nil, err
+		}
+	}
+
+	if req.VolSize > zvolProps.Volsize && zvolProps.Refreservation > 0 {
+		if err := checkParentSpace(zfsVolume.Dataset, req.VolSize-zvolProps.Volsize); err != nil {
+			return nil, err
+		}
+	}
+
+	resize := func() error {
+		if err := zfsVolume.SetProp("volsize", req.VolSize); err != nil {
+			return err
+		}
+
+		if err := zfsVolume.RefreshProps(); err != nil {
+			return err
+		}
+		volsize := zfsVolume.Props.(*zfs.VolDataset).Volsize
+
+		// change meta information for stmf lu
+		unlockComstar := locks.LockComstar()
+		err := lu.ModifyWithProps(stmf.LuProperties{Size: volsize})
+		unlockComstar()
+		if err != nil {
+			code, message := publicError(err)
+			return &Error{
+				Err:    fmt.Errorf("Zvol resized to %d, but logical unit size was not changed: %s", volsize, message),
+				Debug:  fmt.Sprintf("LU: %s, zvol: %s, err: %s", lu.LUName, zfsVolume.Dataset, err),
+				Stderr: "",
+				Kind:   code,
+			}
+		}
+
+		if lu.Size != volsize {
+			return &Error{
+				Err:    fmt.Errorf("Size mismatch: zvol size is %d, logical unit size is %d", volsize, lu.Size),
+				Debug:  fmt.Sprintf("LU: %s, zvol: %s", lu.LUName, zfsVolume.Dataset),
+				Stderr: "",
+			}
+		}
+		return nil
+	}
+
+	var transitions []StatusTransition
+	if quiesce {
+		transitions, err = quiesceLu(lu, resize)
+	} else {
+		err = resize()
+	}
+	inv.UpdateLu(lu)
+	if err != nil {
+		return nil, err
+	}
+
+	volume := inv.Volume(lu)
+	volume.Transitions = transitions
+
+	return &volume, nil
+}
+
+// checkResize - validate requested size against direction, volblocksize
+// alignment and volume usage
+func checkResize(lu *stmf.LogicalUnit, zvolProps *zfs.VolDataset, req ZvolResizeRequest, direction int) error {
+	if req.VolSize == 0 {
+		return &Error{
+			Err:    errors.New("Volume size must be greater than zero"),
 			Debug:  "",
 			Stderr: "",
 		}
 	}
 
-	zfsVolume, err := zfs.GetDataset(lu.GetZvol())
+	if zvolProps.Volblocksize > 0 && req.VolSize%zvolProps.Volblocksize != 0 {
+		return &Error{
+			Err:    fmt.Errorf("Volume size %d is not a multiple of volblocksize %d", req.VolSize, zvolProps.Volblocksize),
+			Debug:  "",
+			Stderr: "",
+		}
+	}
+
+	switch {
+	case req.VolSize > zvolProps.Volsize && direction == resizeShrink:
+		return &Error{
+			Err:    fmt.Errorf("Volume size %d is greater than current size %d", req.VolSize, zvolProps.Volsize),
+			Debug:  "",
+			Stderr: "",
+		}
+	case req.VolSize < zvolProps.Volsize && direction == resizeGrow:
+		return &Error{
+			Err:    fmt.Errorf("Volume size %d is less than current size %d", req.VolSize, zvolProps.Volsize),
+			Debug:  "",
+			Stderr: "",
+		}
+	case req.VolSize == zvolProps.Volsize:
+		return &Error{
+			Err:    fmt.Errorf("Volume already has size %d", req.VolSize),
+			Debug:  "",
+			Stderr: "",
+		}
+	}
+
+	if req.VolSize > zvolProps.Volsize {
+		return nil
+	}
+
+	// shrinking loses data at the end of the volume
+	if !req.Force {
+		return &Error{
+			Err:    errors.New("Shrinking volume may destroy data. Use force to override"),
+			Debug:  fmt.Sprintf("LU: %s, size: %d, requested: %d", lu.LUName, zvolProps.Volsize, req.VolSize),
+			Stderr: "",
+		}
+	}
+
+	views, err := lu.ListView()
 	if err != nil {
 		return err
 	}
+	if len(views) > 0 {
+		return &Error{
+			Err:    fmt.Errorf("Volume has %d view(s). Unexport volume before shrinking", len(views)),
+			Kind:   codeBusy,
+			Debug:  fmt.Sprintf("LU: %s", lu.LUName),
+			Stderr: "",
+		}
+	}
 
-	if err := zfsVolume.SetProp("volsize", newSize); err != nil {
+	return checkNoSessions(lu)
+}
+
+// checkParentSpace - check that parent dataset has enough available space
+// for the thick volume to grow by delta bytes
+func checkParentSpace(zvol string, delta uint64) error {
+	parent, err := zfs.GetDataset(path.Dir(zvol))
+	if err != nil {
 		return err
 	}
 
-	if err := zfsVolume.RefreshProps(); err != nil {
+	if err := parent.RefreshProps(); err != nil {
 		return err
 	}
 
-	// change meta information for stmf lu
-	lu.Modify(fmt.Sprintf("-s %d", zfsVolume.Props.(*zfs.VolDataset).Volsize))
+	available := parent.Props.(*zfs.FsDataset).Available
+	if available < delta {
+		return &Error{
+			Err:    fmt.Errorf("Not enough space: %d bytes required, %d bytes available", delta, available),
+			Debug:  fmt.Sprintf("Zvol: %s, parent: %s", zvol, parent.Dataset),
+			Stderr: "",
+		}
+	}
+	return nil
+}
+
+// quiesceLu - take logical unit offline for the duration of operation.
+// Logical unit is brought back online even if operation failed.
+// Caller must hold lock of the logical unit.
+func quiesceLu(lu *stmf.LogicalUnit, operation func() error) ([]StatusTransition, error) {
+	var transitions []StatusTransition
+
+	from := lu.OperationalStatus
+	unlockComstar := locks.LockComstar()
+	err := lu.Offline()
+	unlockComstar()
 	if err != nil {
-		return err
+		return transitions, err
 	}
+	transitions = append(transitions, newStatusTransition(from, lu.OperationalStatus))
 
-	return nil
+	operationErr := operation()
+
+	from = lu.OperationalStatus
+	unlockComstar = locks.LockComstar()
+	err = lu.Online()
+	unlockComstar()
+	if err == nil {
+		transitions = append(transitions, newStatusTransition(from, lu.OperationalStatus))
+	}
+
+	if operationErr != nil {
+		return transitions, operationErr
+	}
+	return transitions, err
 }
 
-func VolDestroy(lu_uuid string) error {
+func newStatusTransition(from, to string) StatusTransition {
+	return StatusTransition{
+		From: from,
+		To:   to,
+		Time: time.Now().Format(time.RFC3339),
+	}
+}
+
+// VolSetOnline - bring logical unit online or take it offline
+func VolSetOnline(lu_uuid string, online bool) (*Volume, error) {
+	lu, err := stmf.GetLu(lu_uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock := locks.Lock(luLockKey(lu.LUName))
+	defer unlock()
+
+	from := lu.OperationalStatus
 
+	unlockComstar := locks.LockComstar()
+	if online {
+		err = lu.Online()
+	} else {
+		err = lu.Offline()
+	}
+	unlockComstar()
+	if err != nil {
+		return nil, err
+	}
+	inv.UpdateLu(lu)
+
+	volume := inv.Volume(lu)
+	volume.Transitions = []StatusTransition{newStatusTransition(from, lu.OperationalStatus)}
+
+	return &volume, nil
+}
+
+// VolDestroy - two-phase volume destroy. The zvol is marked as deleting
+// first, so an interrupted destroy is resumed by the delete sweeper.
+func VolDestroy(lu_uuid string) error {
 	lu, err := stmf.GetLu(lu_uuid)
-	vol_mutex.Lock()
-	err = lu.Delete(false)
 	if err != nil {
-		vol_mutex.Unlock()
 		return err
 	}
-	// sleep 50ms to ensure we not catch setuation like this:
-	// stmfadm[3928]: [ID 155448 user.error] transaction commit for provider_data_pg_sbd failed - object already exists
-	time.Sleep(100)
-	vol_mutex.Unlock()
 
-	zfsVolume, err := zfs.GetDataset(lu.GetZvol())
+	unlock := locks.Lock(luLockKey(lu.LUName), zvolLockKey(lu.GetZvol()))
+	defer unlock()
+
+	if err := markVolDeleting(lu.GetZvol()); err != nil {
+		return err
+	}
+
+	return resumeVolDestroy(lu.GetZvol())
+}
+
+// markVolDeleting - first phase of volume destroy. Zvol marked as deleting is
+// hidden from clients and destroyed by resumeVolDestroy or delete sweeper.
+// Caller must hold locks of the zvol and its logical unit.
+func markVolDeleting(zvol string) error {
+	zfsVolume := &zfs.Dataset{Dataset: zvol}
+
+	if err := zfsVolume.SetProp("custom:sflag", sflagDeleting); err != nil {
+		return err
+	}
+	inv.SetZvolProp(zvol, "custom:sflag", sflagDeleting)
+
+	return nil
+}
+
+// markVolManaged - cancel first phase of volume destroy.
+// Caller must hold locks of the zvol and its logical unit.
+func markVolManaged(zvol string) error {
+	zfsVolume := &zfs.Dataset{Dataset: zvol}
+
+	if err := zfsVolume.SetProp("custom:sflag", sflagManaged); err != nil {
+		return err
+	}
+	inv.SetZvolProp(zvol, "custom:sflag", sflagManaged)
+
+	return nil
+}
+
+// resumeVolDestroy - remove views and logical unit of the zvol marked as
+// deleting (if it still exists) and then destroy the zvol itself.
+// Caller must hold locks of the zvol and its logical unit.
+func resumeVolDestroy(zvol string) error {
+	lu, err := lookupLuByZvol(zvol)
 	if err != nil {
 		return err
 	}
 
-	return zfsVolume.Destroy("")
+	if lu != nil {
+		unlockComstar := locks.LockComstar()
+		if lu.ViewEntryCount > 0 {
+			if err := lu.RemoveAllView(); err != nil {
+				unlockComstar()
+				return err
+			}
+		}
+
+		err := lu.Delete(false)
+		unlockComstar()
+		if err != nil {
+			return err
+		}
+		inv.RemoveLu(lu.LUName)
+	}
+
+	zfsVolume := &zfs.Dataset{Dataset: zvol}
+
+	if err := zfsVolume.DestroyWithFlags(zfs.DestroyFlags{}); err != nil {
+		return err
+	}
+	inv.RemoveZvol(zvol)
+
+	return nil
+}
+
+// lookupLuByZvol - get logical unit based on zvol.
+// Returns nil without error if zvol is not exported as logical unit.
+func lookupLuByZvol(zvol string) (*stmf.LogicalUnit, error) {
+	lus, err := stmf.ListLUs("")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, lu := range lus {
+		if lu.DataFile == stmf.RDSK_DEFAULT_PREFIX+zvol {
+			return lu, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// newVolume - wrap logical unit with the state of its zvol
+func newVolume(lu *stmf.LogicalUnit, sflag string) Volume {
+	volume := Volume{LogicalUnit: *lu, State: volStateHealthy}
+
+	if sflag == sflagDeleting {
+		volume.State = volStateDeleting
+	}
+	return volume
 }
 
 func VolSnapshot(lu_uuid, snapname string) (*zfs.Dataset, error) {
@@ -152,6 +574,9 @@ func VolSnapshot(lu_uuid, snapname string) (*zfs.Dataset, error) {
 		return nil, err
 	}
 
+	unlock := locks.Lock(zvolLockKey(lu.GetZvol()))
+	defer unlock()
+
 	zfsVolume, err := zfs.GetDataset(lu.GetZvol())
 	if err != nil {
 		return nil, err
@@ -175,39 +600,71 @@ func GetSnapshot(lu_uuid, snapshotName string) (*zfs.Dataset, error) {
 	return zfs.GetDataset(lu.GetZvol() + "@" + snapshotName)
 }
 
-func VolRollback(lu_uuid, snapshotName string) error {
+// VolRollback - rollback volume to snapshot. By default logical unit is
+// deleted (views are kept) and recreated with the same GUID. If quiesce is
+// set, logical unit is taken offline during rollback instead.
+func VolRollback(lu_uuid, snapshotName string, quiesce bool) (*Volume, error) {
 	lu, err := stmf.GetLu(lu_uuid)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	unlock := locks.Lock(luLockKey(lu.LUName), zvolLockKey(lu.GetZvol()))
+	defer unlock()
+
 	zfsVolume, err := zfs.GetDataset(lu.GetZvol())
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	saved_alias := lu.Alias
+	if quiesce {
+		transitions, err := quiesceLu(lu, func() error {
+			return zfsVolume.Rollback(zfsVolume.Dataset + "@" + snapshotName)
+		})
+		inv.UpdateLu(lu)
+		if err != nil {
+			return nil, err
+		}
+
+		volume := inv.Volume(lu)
+		volume.Transitions = transitions
+		return &volume, nil
+	}
+
+	// logical unit is recreated with the same identity and settings
+	props := luIdentityProps(lu)
 
 	// delete stmf lu with keepViews option
+	unlockComstar := locks.LockComstar()
 	err = lu.Delete(true)
+	unlockComstar()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = zfsVolume.Rollback(zfsVolume.Dataset + "@" + snapshotName)
+	rollbackErr := zfsVolume.Rollback(zfsVolume.Dataset + "@" + snapshotName)
+
+	// logical unit is restored even if rollback failed
+	unlockComstar = locks.LockComstar()
+	restoredLu, err := stmf.CreateLuWithProps(zfsVolume.Dataset, props)
+	unlockComstar()
 	if err != nil {
-		return err
+		if rollbackErr != nil {
+			log.Printf("Can't restore LU %s on %s. Err: %s", lu.LUName, zfsVolume.Dataset, err.Error())
+			return nil, rollbackErr
+		}
+		return nil, err
 	}
+	inv.UpdateLu(restoredLu)
 
-	// create logical unit with saved guid option and alias
-	_, err = stmf.CreateLu(zfsVolume.Dataset, "-p guid="+lu_uuid+" -p alias="+saved_alias)
-	if err != nil {
-		return err
+	if rollbackErr != nil {
+		return nil, rollbackErr
 	}
 
-	return nil
+	volume := inv.Volume(restoredLu)
+	return &volume, nil
 }
 
-func VolCloneFromSnapshot(lu_uuid, snapname, cloneAlias string) (*stmf.LogicalUnit, error) {
+func VolCloneFromSnapshot(lu_uuid, snapname, cloneAlias string, exports []ExportRequest) (*stmf.LogicalUnit, error) {
 	lu, err := stmf.GetLu(lu_uuid)
 	if err != nil {
 		return nil, err
@@ -216,15 +673,506 @@ func VolCloneFromSnapshot(lu_uuid, snapname, cloneAlias string) (*stmf.LogicalUn
 		strings.Split(lu.GetZvol(), "/")[0:len(strings.Split(lu.GetZvol(), "/"))-1], "/")
 
 	cloneName := basepath + "/" + cloneAlias
-	cloneZfsVolume, err := zfs.CreateFromSnapshot(lu.GetZvol()+"@"+snapname, cloneName, "")
+
+	lockKeys := append(exportLockKeys(exports), projectLockKey(basepath), zvolLockKey(lu.GetZvol()), zvolLockKey(cloneName))
+	unlock := locks.Lock(lockKeys...)
+	defer unlock()
+
+	// clone provisions the same size as origin volume
+	if err := checkProvisioning(basepath, lu.Size); err != nil {
+		return nil, err
+	}
+
+	cloneZfsVolume, err := zfs.CloneWithProps(lu.GetZvol()+"@"+snapname, cloneName, zfs.PropertyMap{"custom:sflag": sflagManaged})
 	if err != nil {
 		return nil, err
 	}
 
-	clonedLu, err := stmf.CreateLu(cloneZfsVolume.Dataset, "-p alias="+cloneAlias)
+	unlockComstar := locks.LockComstar()
+	clonedLu, err := stmf.CreateLuWithProps(cloneZfsVolume.Dataset, stmf.LuProperties{Alias: cloneAlias})
+	unlockComstar()
 	if err != nil {
+		destroyNewZvol(cloneZfsVolume)
+		return nil, err
+	}
+	inv.SetZvolProp(cloneZfsVolume.Dataset, "custom:sflag", sflagManaged)
+	inv.UpdateLu(clonedLu)
+
+	if err := exportNewVolume(clonedLu, cloneZfsVolume, exports); err != nil {
 		return nil, err
 	}
 
 	return clonedLu, nil
 }
+
+// VolRename - rename zvol and sync logical unit metadata (data file and alias).
+// Logical unit is recreated with the same GUID, so views are preserved.
+// Rename is refused while logical unit has active sessions, unless force is set.
+func VolRename(lu_uuid, newAlias string, force bool) (*stmf.LogicalUnit, error) {
+	lu, err := stmf.GetLu(lu_uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	oldZvol := lu.GetZvol()
+	newZvol := path.Dir(oldZvol) + "/" + newAlias
+
+	unlock := locks.Lock(luLockKey(lu.LUName), zvolLockKey(oldZvol), zvolLockKey(newZvol))
+	defer unlock()
+
+	if !force {
+		if err := checkNoSessions(lu); err != nil {
+			return nil, err
+		}
+	}
+
+	// zvol name not changed, update alias only
+	if newZvol == oldZvol {
+		unlockComstar := locks.LockComstar()
+		err := lu.ModifyWithProps(stmf.LuProperties{Alias: newAlias})
+		unlockComstar()
+		if err != nil {
+			return nil, err
+		}
+		inv.UpdateLu(lu)
+		return lu, nil
+	}
+
+	return relocateLu(lu, newZvol, newAlias)
+}
+
+// relocateLu - rename zvol within the pool and recreate logical unit on the
+// new zvol with the same identity. Caller must hold locks of the LU and both zvols.
+func relocateLu(lu *stmf.LogicalUnit, newZvol, alias string) (*stmf.LogicalUnit, error) {
+	oldZvol := lu.GetZvol()
+	oldProps := luIdentityProps(lu)
+	newProps := luIdentityProps(lu)
+	newProps.Alias = alias
+
+	// delete stmf lu with keepViews option
+	unlockComstar := locks.LockComstar()
+	err := lu.Delete(true)
+	unlockComstar()
+	if err != nil {
+		return nil, err
+	}
+
+	// restore logical unit on the old zvol
+	restoreLu := func() {
+		unlockComstar := locks.LockComstar()
+		_, restoreErr := stmf.CreateLuWithProps(oldZvol, oldProps)
+		unlockComstar()
+		if restoreErr != nil {
+			log.Printf("Can't restore LU %s on %s. Err: %s", lu.LUName, oldZvol, restoreErr.Error())
+		}
+	}
+
+	zfsVolume := &zfs.Dataset{Dataset: oldZvol}
+	if err := zfsVolume.Rename(newZvol); err != nil {
+		restoreLu()
+		return nil, err
+	}
+
+	unlockComstar = locks.LockComstar()
+	relocatedLu, err := stmf.CreateLuWithProps(newZvol, newProps)
+	unlockComstar()
+	if err != nil {
+		// rename zvol back, otherwise it is left without logical unit
+		if renameErr := zfsVolume.Rename(oldZvol); renameErr != nil {
+			log.Printf("Can't rename zvol %s back to %s. Err: %s", newZvol, oldZvol, renameErr.Error())
+			return nil, err
+		}
+		restoreLu()
+		return nil, err
+	}
+
+	inv.RenameZvol(oldZvol, newZvol)
+	inv.UpdateLu(relocatedLu)
+
+	return relocatedLu, nil
+}
+
+// luIdentityProps - create-lu properties which keep identity of the logical unit
+// (guid, alias, serial number, block size, vendor/product id and cache settings)
+// when it is recreated.
+func luIdentityProps(lu *stmf.LogicalUnit) stmf.LuProperties {
+	writeProtect := lu.WriteProtect == "Enabled"
+	writeCacheDisabled := lu.WritebackCache == "Disabled"
+
+	props := stmf.LuProperties{
+		Guid:               lu.LUName,
+		Alias:              lu.Alias,
+		BlockSize:          lu.BlockSize,
+		WriteProtect:       &writeProtect,
+		WriteCacheDisabled: &writeCacheDisabled,
+	}
+
+	for _, prop := range []struct {
+		value string
+		field *string
+	}{
+		{lu.SerialNum, &props.Serial},
+		{lu.VendorID, &props.VendorID},
+		{lu.ProductID, &props.ProductID},
+	} {
+		if prop.value != "" && prop.value != "not set" {
+			*prop.field = prop.value
+		}
+	}
+
+	if lu.ManagementURL != "" && lu.ManagementURL != "not set" {
+		managementURL := lu.ManagementURL
+		props.ManagementURL = &managementURL
+	}
+
+	return props
+}
+
+// checkNoSessions - returns error if logical unit has active sessions
+func checkNoSessions(lu *stmf.LogicalUnit) error {
+	sessions, err := luSessions(lu)
+	if err != nil {
+		return err
+	}
+
+	if len(sessions) > 0 {
+		return &Error{
+			Err:    fmt.Errorf("Volume has %d active session(s). Use force to override", len(sessions)),
+			Kind:   codeBusy,
+			Debug:  fmt.Sprintf("LU: %s, sessions: %v", lu.LUName, sessions),
+			Stderr: "",
+		}
+	}
+	return nil
+}
+
+// VolMove - move volume into another project (pool/domain/project).
+// Within the same pool zvol is renamed, across pools it is replicated with
+// zfs send/recv. Logical unit is recreated with the same GUID and serial
+// number, so initiators see the same device, and original views are reattached.
+func VolMove(lu_uuid, targetBasepath string, force bool) (*stmf.LogicalUnit, error) {
+	lu, err := stmf.GetLu(lu_uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	oldZvol := lu.GetZvol()
+	newZvol := targetBasepath + "/" + path.Base(oldZvol)
+
+	if newZvol == oldZvol {
+		return nil, &Error{
+			Err:    errors.New("Volume already belongs to specified project"),
+			Debug:  fmt.Sprintf("LU: %s, zvol: %s", lu.LUName, oldZvol),
+			Stderr: "",
+		}
+	}
+
+	unlock := locks.Lock(luLockKey(lu.LUName), zvolLockKey(oldZvol), zvolLockKey(newZvol), projectLockKey(targetBasepath))
+	defer unlock()
+
+	if !force {
+		if err := checkNoSessions(lu); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := checkProvisioning(targetBasepath, lu.Size); err != nil {
+		return nil, err
+	}
+
+	views, err := lu.ListView()
+	if err != nil {
+		return nil, err
+	}
+
+	var movedLu *stmf.LogicalUnit
+	if poolOfDataset(oldZvol) == poolOfDataset(newZvol) {
+		movedLu, err = relocateLu(lu, newZvol, lu.Alias)
+	} else {
+		movedLu, err = replicateLu(lu, newZvol)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := reattachViews(movedLu, views); err != nil {
+		return nil, err
+	}
+
+	return movedLu, nil
+}
+
+// replicateLu - replicate zvol into another pool and recreate logical unit
+// on the replica with the same identity. Initial stream is sent while volume
+// is online, final incremental stream is sent after logical unit is deleted.
+// Caller must hold locks of the LU and both zvols.
+func replicateLu(lu *stmf.LogicalUnit, newZvol string) (*stmf.LogicalUnit, error) {
+	oldZvol := lu.GetZvol()
+	props := luIdentityProps(lu)
+	source := &zfs.Dataset{Dataset: oldZvol}
+	snapPrefix := moveSnapshotPrefix + strconv.FormatInt(time.Now().Unix(), 10)
+
+	initialSnapshot, err := source.Snapshot(snapPrefix + "_initial")
+	if err != nil {
+		return nil, err
+	}
+
+	// remove replica (it could be partially received) and replication
+	// snapshots of the source zvol
+	cleanup := func() {
+		datasets := []string{newZvol}
+		for _, suffix := range []string{"_initial", "_final"} {
+			datasets = append(datasets, oldZvol+"@"+snapPrefix+suffix)
+		}
+
+		for _, dataset := range datasets {
+			err := (&zfs.Dataset{Dataset: dataset}).DestroyWithFlags(zfs.DestroyFlags{Recursive: true})
+			if err != nil && !errors.Is(err, zfs.ErrNotFound) {
+				log.Printf("Can't destroy %s. Err: %s", dataset, err.Error())
+			}
+		}
+	}
+
+	if err := initialSnapshot.SendRecv(newZvol, ""); err != nil {
+		cleanup()
+		return nil, err
+	}
+
+	// restore logical unit on the source zvol and remove replica
+	rollback := func(err error) (*stmf.LogicalUnit, error) {
+		unlockComstar := locks.LockComstar()
+		if _, restoreErr := stmf.CreateLuWithProps(oldZvol, props); restoreErr != nil {
+			log.Printf("Can't restore LU %s on %s. Err: %s", lu.LUName, oldZvol, restoreErr.Error())
+		}
+		unlockComstar()
+
+		cleanup()
+		return nil, err
+	}
+
+	// stop io, delete stmf lu with keepViews option
+	unlockComstar := locks.LockComstar()
+	err = lu.Delete(true)
+	unlockComstar()
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+
+	finalSnapshot, err := source.Snapshot(snapPrefix + "_final")
+	if err != nil {
+		return rollback(err)
+	}
+
+	if err := finalSnapshot.SendRecv(newZvol, initialSnapshot.Dataset); err != nil {
+		return rollback(err)
+	}
+
+	unlockComstar = locks.LockComstar()
+	movedLu, err := stmf.CreateLuWithProps(newZvol, props)
+	unlockComstar()
+	if err != nil {
+		return rollback(err)
+	}
+
+	inv.RenameZvol(oldZvol, newZvol)
+	inv.UpdateLu(movedLu)
+
+	// cleanup source zvol and replication snapshots. Source is marked as
+	// deleting first, so delete sweeper finishes destroy if it fails here.
+	if err := markVolDeleting(oldZvol); err != nil {
+		log.Printf("Can't mark source zvol %s as deleting. Err: %s", oldZvol, err.Error())
+	}
+	if err := source.DestroyWithFlags(zfs.DestroyFlags{Recursive: true}); err != nil {
+		log.Printf("Can't destroy source zvol %s. Err: %s", oldZvol, err.Error())
+	} else {
+		inv.RemoveZvol(oldZvol)
+	}
+
+	for _, suffix := range []string{"_initial", "_final"} {
+		snapshot := &zfs.Dataset{Dataset: newZvol + "@" + snapPrefix + suffix}
+		if err := snapshot.DestroyWithFlags(zfs.DestroyFlags{}); err != nil {
+			log.Printf("Can't destroy snapshot %s. Err: %s", snapshot.Dataset, err.Error())
+		}
+	}
+
+	return movedLu, nil
+}
+
+// reattachViews - add views missing on the logical unit
+func reattachViews(lu *stmf.LogicalUnit, views []stmf.View) error {
+	unlockComstar := locks.LockComstar()
+	defer unlockComstar()
+
+	for _, view := range views {
+		hostGroup, targetGroup := view.HostGroup, view.TargetGroup
+		if hostGroup == "All" {
+			hostGroup = ""
+		}
+		if targetGroup == "All" {
+			targetGroup = ""
+		}
+
+		if _, err := lu.GetViewEntry(hostGroup, targetGroup); err == nil {
+			continue
+		}
+
+		if _, err := lu.AddView(hostGroup, targetGroup, int64(view.LUN)); err != nil {
+			return err
+		}
+	}
+
+	inv.UpdateLu(lu)
+
+	return nil
+}
+
+func poolOfDataset(dataset string) string {
+	return strings.Split(dataset, "/")[0]
+}
+
+// VolModify - modify logical unit and zvol properties.
+// Vendor and product id can be set only at create time, so logical unit is
+// recreated with the same identity (views are preserved) if they are changed.
+func VolModify(lu_uuid string, req ZVolPatchRequest) (*Volume, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	lu, err := stmf.GetLu(lu_uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock := locks.Lock(luLockKey(lu.LUName), zvolLockKey(lu.GetZvol()))
+	defer unlock()
+
+	zfsVolume, err := zfs.GetDataset(lu.GetZvol())
+	if err != nil {
+		return nil, err
+	}
+
+	// current values are saved to restore zvol properties if logical unit
+	// can't be modified
+	if err := zfsVolume.RefreshProps(); err != nil {
+		return nil, err
+	}
+	savedZfsProps := zfsVolume.Properties
+
+	var copies *string
+	if req.Copies != nil {
+		value := strconv.FormatUint(*req.Copies, 10)
+		copies = &value
+	}
+
+	// zvol properties
+	zfsProps := []struct {
+		name  string
+		value *string
+	}{
+		{"sync", req.Sync},
+		{"logbias", req.Logbias},
+		{"primarycache", req.Primarycache},
+		{"secondarycache", req.Secondarycache},
+		{"copies", copies},
+	}
+
+	var applied []string
+	restoreZfsProps := func() {
+		for _, name := range applied {
+			if err := restoreZfsProp(zfsVolume, name, savedZfsProps[name]); err != nil {
+				log.Printf("Can't restore %s of %s. Err: %s", name, zfsVolume.Dataset, err.Error())
+			}
+		}
+	}
+
+	for _, prop := range zfsProps {
+		if prop.value != nil {
+			if err := zfsVolume.SetProp(prop.name, *prop.value); err != nil {
+				restoreZfsProps()
+				return nil, err
+			}
+			applied = append(applied, prop.name)
+		}
+	}
+
+	// logical unit properties
+	luProps := stmf.LuProperties{
+		ManagementURL:      req.ManagementURL,
+		WriteProtect:       req.WriteProtect,
+		WriteCacheDisabled: req.WriteCacheDisabled,
+	}
+
+	if req.VendorID != nil || req.ProductID != nil {
+		props := luIdentityProps(lu)
+		savedProps := luIdentityProps(lu)
+
+		if req.VendorID != nil {
+			props.VendorID = *req.VendorID
+		}
+		if req.ProductID != nil {
+			props.ProductID = *req.ProductID
+		}
+		if luProps.WriteProtect != nil {
+			props.WriteProtect = luProps.WriteProtect
+		}
+		if luProps.WriteCacheDisabled != nil {
+			props.WriteCacheDisabled = luProps.WriteCacheDisabled
+		}
+		if luProps.ManagementURL != nil {
+			// recreated logical unit has no management URL unless passed
+			props.ManagementURL = nil
+			if *luProps.ManagementURL != "" {
+				props.ManagementURL = luProps.ManagementURL
+			}
+		}
+
+		unlockComstar := locks.LockComstar()
+		err := lu.Delete(true)
+		if err != nil {
+			unlockComstar()
+			restoreZfsProps()
+			return nil, err
+		}
+
+		recreatedLu, err := stmf.CreateLuWithProps(zfsVolume.Dataset, props)
+		if err != nil {
+			// restore logical unit with previous properties
+			if _, restoreErr := stmf.CreateLuWithProps(zfsVolume.Dataset, savedProps); restoreErr != nil {
+				log.Printf("Can't restore LU %s on %s. Err: %s", lu.LUName, zfsVolume.Dataset, restoreErr.Error())
+			}
+			unlockComstar()
+			restoreZfsProps()
+			return nil, err
+		}
+		unlockComstar()
+		lu = recreatedLu
+	} else {
+		unlockComstar := locks.LockComstar()
+		err := lu.ModifyWithProps(luProps)
+		unlockComstar()
+		if err != nil {
+			restoreZfsProps()
+			return nil, err
+		}
+	}
+	inv.UpdateLu(lu)
+
+	if err := zfsVolume.RefreshProps(); err != nil {
+		return nil, err
+	}
+
+	volume := inv.Volume(lu)
+	volume.Zvol = zfsVolume.Props.(*zfs.VolDataset)
+
+	return &volume, nil
+}
+
+// restoreZfsProp - restore saved property value. Property which wasn't set
+// locally is inherited again.
+func restoreZfsProp(dataset *zfs.Dataset, name string, saved zfs.Property) error {
+	if saved.Source != zfs.SourceLocal {
+		return dataset.InheritProp(name)
+	}
+	return dataset.SetProp(name, saved.Value)
+}
@@ -42,8 +42,26 @@ func main() {
 		log.Fatal(err.Error())
 	}
 
+	err = znstor.ConfigureLunRange(config.Luns)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	znstor.ConfigureIdempotencyWindow(config.IdempotencyWindow)
+
+	// tag clones created without service flag by earlier versions
+	if err := znstor.MigrateUnflaggedVolumes(); err != nil {
+		log.Printf("Can't migrate unflagged volumes. Err: %s", err.Error())
+	}
+
+	// resume interrupted volume destroys
+	znstor.StartDeleteSweeper()
+
+	// periodically reload cached inventory of logical units and zvols
+	znstor.StartInventoryRefresh()
+
 	// load routes
-	router := znstor.NewRouter(io.Writer(lf), config.Auth.UserName, config.Auth.UserPassword)
+	router := znstor.NewRouter(io.Writer(lf), config.Auth, config.Admin)
 
 	// start http server
 	log.Fatal(http.ListenAndServe(config.Listen+":10987", router))